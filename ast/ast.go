@@ -2,7 +2,9 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"monkey/token"
+	"sort"
 	"strings"
 	// "strings"
 )
@@ -10,6 +12,10 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	// Pos is the position of the first character of the node, End the position right after its last one.
+	// A node whose last child is missing after a parse error ends with its own token.
+	Pos() token.Position
+	End() token.Position
 }
 
 type Statement interface {
@@ -30,6 +36,13 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression == nil {
+		return es.Token.End
+	}
+	return es.Expression.End()
+}
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -50,6 +63,20 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -67,6 +94,13 @@ type LetStatement struct {
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
+func (ls *LetStatement) End() token.Position {
+	if ls.Value == nil {
+		return ls.Name.Token.End
+	}
+	return ls.Value.End()
+}
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
@@ -88,6 +122,8 @@ type Identifier struct {
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 func (i *Identifier) String() string       { return i.Value }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
+func (i *Identifier) End() token.Position  { return i.Token.End }
 
 type ReturnStatement struct {
 	Token       token.Token
@@ -96,6 +132,13 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (ls *ReturnStatement) TokenLiteral() string { return ls.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue == nil {
+		return rs.Token.End
+	}
+	return rs.ReturnValue.End()
+}
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(rs.TokenLiteral() + " ")
@@ -106,6 +149,78 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+type WhileStatement struct {
+	Token     token.Token // the while token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+func (ws *WhileStatement) End() token.Position {
+	if ws.Body == nil {
+		return ws.Token.End
+	}
+	return ws.Body.End()
+}
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("while(")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(")\n")
+	out.WriteString(ws.Body.String())
+	return out.String()
+}
+
+// ForInStatement is for (Variable in Iterable) Body
+type ForInStatement struct {
+	Token    token.Token // the for token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode()       {}
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForInStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForInStatement) End() token.Position {
+	if fs.Body == nil {
+		return fs.Token.End
+	}
+	return fs.Body.End()
+}
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for(")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(")\n")
+	out.WriteString(fs.Body.String())
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string       { return bs.Token.Literal + ";" }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) End() token.Position  { return bs.Token.End }
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return cs.Token.Literal + ";" }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) End() token.Position  { return cs.Token.End }
+
 type IfExpression struct {
 	Token       token.Token
 	Condition   Expression
@@ -115,6 +230,16 @@ type IfExpression struct {
 
 func (is *IfExpression) expressionNode()      {}
 func (is *IfExpression) TokenLiteral() string { return is.Token.Literal }
+func (is *IfExpression) Pos() token.Position  { return is.Token.Pos }
+func (is *IfExpression) End() token.Position {
+	if is.Altenative != nil {
+		return is.Altenative.End()
+	}
+	if is.Consequence == nil {
+		return is.Token.End
+	}
+	return is.Consequence.End()
+}
 func (is *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString(is.TokenLiteral())
@@ -134,7 +259,9 @@ func (is *IfExpression) String() string {
 }
 
 type BlockStatement struct {
+	Token      token.Token // the { token
 	Statements []Statement
+	Rbrace     token.Token
 }
 
 func (b *BlockStatement) expressionNode() {}
@@ -146,6 +273,9 @@ func (b *BlockStatement) TokenLiteral() string {
 	}
 }
 
+func (b *BlockStatement) Pos() token.Position { return b.Token.Pos }
+func (b *BlockStatement) End() token.Position { return b.Rbrace.End }
+
 func (b *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -158,11 +288,26 @@ func (b *BlockStatement) String() string {
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	// Big holds the value instead of Value when the literal doesn't fit in an int64
+	Big *big.Int
 }
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position  { return il.Token.End }
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FloatLiteral) End() token.Position  { return fl.Token.End }
 
 type BooleanLiteral struct {
 	Token token.Token
@@ -172,6 +317,8 @@ type BooleanLiteral struct {
 func (bl *BooleanLiteral) expressionNode()      {}
 func (bl *BooleanLiteral) TokenLiteral() string { return bl.Token.Literal }
 func (bl *BooleanLiteral) String() string       { return (bl.Token.Literal + "(tok)") }
+func (bl *BooleanLiteral) Pos() token.Position  { return bl.Token.Pos }
+func (bl *BooleanLiteral) End() token.Position  { return bl.Token.End }
 
 type StringLiteral struct {
 	Token token.Token
@@ -181,15 +328,54 @@ type StringLiteral struct {
 func (str *StringLiteral) expressionNode()      {}
 func (str *StringLiteral) TokenLiteral() string { return str.Token.Literal }
 func (str *StringLiteral) String() string       { return (str.Token.Literal + "(tok)") }
+func (str *StringLiteral) Pos() token.Position  { return str.Token.Pos }
+func (str *StringLiteral) End() token.Position  { return str.Token.End }
+
+// InterpolatedString is a string with ${} interpolations, its Parts are the *StringLiteral texts
+// between the interpolations and the interpolated expressions, in order. Empty texts are left out.
+type InterpolatedString struct {
+	Token token.Token // the STRING_START token
+	Parts []Expression
+	Tail  token.Token // the STRING_END token
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) Pos() token.Position  { return is.Token.Pos }
+func (is *InterpolatedString) End() token.Position  { return is.Tail.End }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+	out.WriteString("\"")
+	for _, part := range is.Parts {
+		if lit, ok := part.(*StringLiteral); ok {
+			out.WriteString(lit.Value)
+			continue
+		}
+		out.WriteString("${")
+		out.WriteString(part.String())
+		out.WriteString("}")
+	}
+	out.WriteString("\"")
+	return out.String()
+}
 
 type FunctionLiteral struct {
 	Token      token.Token // the fn token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	// Name is the name the function is bound to by a let statement, empty for anonymous functions
+	Name string
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body == nil {
+		return fl.Token.End
+	}
+	return fl.Body.End()
+}
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	out.WriteString(fl.TokenLiteral())
@@ -207,16 +393,41 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// CallExpression is Function(Arguments), or a use of a user-defined infix operator, Left op Right,
+// which calls the function named (op) with the 2 operands as its Arguments.
 type CallExpression struct {
-	Token     token.Token // '(' token
+	Token     token.Token // '(' token, or the operator token
 	Function  Expression
 	Arguments []Expression
+	Rparen    token.Token
+	// Operator is the symbol of the user-defined infix operator, empty for a plain call
+	Operator string
 }
 
 func (c *CallExpression) expressionNode()      {}
 func (c *CallExpression) TokenLiteral() string { return c.Token.Literal }
+func (c *CallExpression) Pos() token.Position {
+	if c.Operator != "" {
+		return c.Arguments[0].Pos()
+	}
+	return c.Function.Pos()
+}
+func (c *CallExpression) End() token.Position {
+	if c.Operator != "" {
+		return c.Arguments[1].End()
+	}
+	return c.Rparen.End
+}
 func (c *CallExpression) String() string {
 	var out bytes.Buffer
+	if c.Operator != "" {
+		out.WriteString("(")
+		out.WriteString(c.Arguments[0].String())
+		out.WriteString(c.Operator)
+		out.WriteString(c.Arguments[1].String())
+		out.WriteString(")")
+		return out.String()
+	}
 	out.WriteString(c.Function.String())
 	out.WriteString("(")
 	for _, arg := range c.Arguments {
@@ -231,10 +442,13 @@ func (c *CallExpression) String() string {
 type ArrayLiteral struct {
 	Token    token.Token // '[' token
 	Elements []Expression
+	Rbracket token.Token
 }
 
 func (arr *ArrayLiteral) expressionNode()      {}
 func (arr *ArrayLiteral) TokenLiteral() string { return arr.Token.Literal }
+func (arr *ArrayLiteral) Pos() token.Position  { return arr.Token.Pos }
+func (arr *ArrayLiteral) End() token.Position  { return arr.Rbracket.End }
 func (arr *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	out.WriteString("[")
@@ -247,13 +461,16 @@ func (arr *ArrayLiteral) String() string {
 }
 
 type ArrayAccessExpression struct {
-	Token token.Token // '[' token
-	Array Expression
-	Index Expression
+	Token    token.Token // '[' token
+	Array    Expression
+	Index    Expression
+	Rbracket token.Token
 }
 
 func (ac *ArrayAccessExpression) expressionNode()      {}
 func (ac *ArrayAccessExpression) TokenLiteral() string { return ac.Token.Literal }
+func (ac *ArrayAccessExpression) Pos() token.Position  { return ac.Array.Pos() }
+func (ac *ArrayAccessExpression) End() token.Position  { return ac.Rbracket.End }
 func (ac *ArrayAccessExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString(ac.Array.String())
@@ -263,18 +480,60 @@ func (ac *ArrayAccessExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression is Left[Low:High], Low and High are nil when they are omitted.
+type SliceExpression struct {
+	Token    token.Token // '[' token
+	Left     Expression
+	Low      Expression
+	High     Expression
+	Rbracket token.Token
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Position  { return se.Left.Pos() }
+func (se *SliceExpression) End() token.Position  { return se.Rbracket.End }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("]")
+	return out.String()
+}
+
 type HashLiteral struct {
-	Token token.Token // '{' token
-	Pairs map[Expression]Expression
+	Token  token.Token // '{' token
+	Pairs  map[Expression]Expression
+	Rbrace token.Token
 }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position  { return hl.Rbrace.End }
+
+// Keys returns the keys of the pairs in source order, the order they are evaluated in. When keys
+// are equal the value of the last one is kept.
+func (hl *HashLiteral) Keys() []Expression {
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].Pos().Offset < keys[j].Pos().Offset })
+	return keys
+}
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys() {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -283,6 +542,38 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 
+// AssignExpression is Target = Value, or a compound assignment like Target += Value.
+// Target is an *Identifier or an *ArrayAccessExpression.
+type AssignExpression struct {
+	Token    token.Token // the assignment token
+	Operator string      // "=", "+=", "-=", "*=" or "/="
+	Target   Expression
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return ae.Target.Pos() }
+func (ae *AssignExpression) End() token.Position {
+	if ae.Value == nil {
+		return ae.Token.End
+	}
+	return ae.Value.End()
+}
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	return out.String()
+}
+
+// BinaryOperator returns the operator a compound assignment applies, e.g. "+" for "+=",
+// and "" for a plain assignment.
+func (ae *AssignExpression) BinaryOperator() string {
+	return strings.TrimSuffix(ae.Operator, "=")
+}
+
 type PrefixExpression struct {
 	Token    token.Token // the prefix token
 	Operator string      // retrived from Token
@@ -291,6 +582,13 @@ type PrefixExpression struct {
 
 func (p *PrefixExpression) expressionNode()      {}
 func (p *PrefixExpression) TokenLiteral() string { return p.Token.Literal }
+func (p *PrefixExpression) Pos() token.Position  { return p.Token.Pos }
+func (p *PrefixExpression) End() token.Position {
+	if p.Right == nil {
+		return p.Token.End
+	}
+	return p.Right.End()
+}
 func (p *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -309,6 +607,13 @@ type InfixExpression struct {
 
 func (p *InfixExpression) expressionNode()      {}
 func (p *InfixExpression) TokenLiteral() string { return p.Token.Literal }
+func (p *InfixExpression) Pos() token.Position  { return p.Left.Pos() }
+func (p *InfixExpression) End() token.Position {
+	if p.Right == nil {
+		return p.Token.End
+	}
+	return p.Right.End()
+}
 func (p *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
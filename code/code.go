@@ -2,6 +2,7 @@ package code
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -36,6 +37,20 @@ const (
 	OpCall
 	OpReturnValue
 	OpReturn
+	OpClosure
+	OpGetFree
+	OpCurrentClosure
+	OpGetBuiltin
+	OpSlice
+	OpSetIndex
+	OpMod
+	OpGreaterEqual
+	OpLessEqual
+	OpBuildString
+	OpGetLocalCell
+	OpGetFreeCell
+	OpSetFree
+	OpCheckIterable
 )
 
 type Definition struct {
@@ -47,20 +62,20 @@ func (instructions Instructions) String() string {
 	var out strings.Builder
 	index := 0
 	for index < len(instructions) {
-		bt := instructions[index]
-		def := definitions[Opcode(bt)]
+		def, err := Lookup(Opcode(instructions[index]))
+		if err != nil {
+			out.WriteString(fmt.Sprintf("ERROR: %s\n", err))
+			index++
+			continue
+		}
 		out.WriteString(fmt.Sprintf("0x%04x", index))
 		index++
 		out.WriteString(" ")
 		out.WriteString(def.Name)
 		for _, width := range def.OperandWidths {
-			for i := 0; i < width; i++ {
-				out.WriteString(" ")
-				out.WriteString(fmt.Sprintf("0x%02x", instructions[index]))
-				index++
-			}
-			// oprand separator
-			out.WriteString("|")
+			out.WriteString(" ")
+			out.WriteString(fmt.Sprintf("%d", readOperand(instructions[index:], width)))
+			index += width
 		}
 		// instruction separator
 		out.WriteString("\n")
@@ -69,33 +84,47 @@ func (instructions Instructions) String() string {
 }
 
 var definitions = map[Opcode]*Definition{
-	Opconst:         {Name: "opConstant", OperandWidths: []int{2}},
-	OpAdd:           {"OpAdd", []int{}},
-	OpSub:           {"OpSub", []int{}},
-	OpMul:           {"OpMul", []int{}},
-	OpDiv:           {"OpDiv", []int{}},
-	OpBang:          {"OpBang", []int{}},
-	OpMinus:         {"OpMinus", []int{}},
-	OpPop:           {"OpPop", []int{}},
-	OpTrue:          {"OpTrue", []int{}},
-	OpFalse:         {"OpFalse", []int{}},
-	OpNull:          {"OpNull", []int{}},
-	OpEqual:         {"OpEqual", []int{}},
-	OpNotEqual:      {"OpNotEqual", []int{}},
-	OpGreaterThan:   {"OpGreaterThan", []int{}},
-	OpLessThan:      {"OpLessThan", []int{}},
-	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
-	OpJump:          {"OpJump", []int{2}},
-	OpGetGlobal:     {"OpGetGlobal", []int{2}},
-	OpSetGlobal:     {"OpSetGlobal", []int{2}},
-	OpGetLocal:      {"OpGetLocal", []int{1}},
-	OpSetLocal:      {"OpSetLocal", []int{1}},
-	OpArray:         {"OPArray", []int{2}},
-	OpIndex:         {"OpIndex", []int{2}},
-	OpHash:          {"OPHash", []int{2}},
-	OpCall:          {"OpCall", []int{}},
-	OpReturnValue:   {"OpReturnValue", []int{}},
-	OpReturn:        {"OpReturn", []int{}},
+	Opconst:          {Name: "OpConstant", OperandWidths: []int{2}},
+	OpAdd:            {"OpAdd", []int{}},
+	OpSub:            {"OpSub", []int{}},
+	OpMul:            {"OpMul", []int{}},
+	OpDiv:            {"OpDiv", []int{}},
+	OpBang:           {"OpBang", []int{}},
+	OpMinus:          {"OpMinus", []int{}},
+	OpPop:            {"OpPop", []int{}},
+	OpTrue:           {"OpTrue", []int{}},
+	OpFalse:          {"OpFalse", []int{}},
+	OpNull:           {"OpNull", []int{}},
+	OpEqual:          {"OpEqual", []int{}},
+	OpNotEqual:       {"OpNotEqual", []int{}},
+	OpGreaterThan:    {"OpGreaterThan", []int{}},
+	OpLessThan:       {"OpLessThan", []int{}},
+	OpJumpNotTruthy:  {"OpJumpNotTruthy", []int{2}},
+	OpJump:           {"OpJump", []int{2}},
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpArray:          {"OpArray", []int{2}},
+	OpIndex:          {"OpIndex", []int{}},
+	OpHash:           {"OpHash", []int{2}},
+	OpCall:           {"OpCall", []int{1}},
+	OpReturnValue:    {"OpReturnValue", []int{}},
+	OpReturn:         {"OpReturn", []int{}},
+	OpClosure:        {"OpClosure", []int{2, 1}}, // constant index, number of free variables
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpSlice:          {"OpSlice", []int{}},
+	OpSetIndex:       {"OpSetIndex", []int{}},
+	OpMod:            {"OpMod", []int{}},
+	OpGreaterEqual:   {"OpGreaterEqual", []int{}},
+	OpLessEqual:      {"OpLessEqual", []int{}},
+	OpBuildString:    {"OpBuildString", []int{2}}, // number of parts
+	OpGetLocalCell:   {"OpGetLocalCell", []int{1}},
+	OpGetFreeCell:    {"OpGetFreeCell", []int{1}},
+	OpSetFree:        {"OpSetFree", []int{1}},
+	OpCheckIterable:  {"OpCheckIterable", []int{}},
 }
 
 func Make(oc Opcode, oprands ...int) []byte {
@@ -135,3 +164,36 @@ func ReadUint16(bytes []byte) uint16 {
 	val := uint16(bytes[0])<<8 | uint16(bytes[1])
 	return val
 }
+
+func ReadUint8(bytes []byte) uint8 {
+	return uint8(bytes[0])
+}
+
+func readOperand(bytes []byte, width int) int {
+	switch width {
+	case 1:
+		return int(ReadUint8(bytes))
+	case 2:
+		return int(ReadUint16(bytes))
+	default:
+		return 0
+	}
+}
+
+// LineEntry maps the instructions from Offset up to the offset of the next entry to a source line.
+type LineEntry struct {
+	Offset int
+	Line   int
+}
+
+// LineTable maps instruction offsets to source lines, its entries are sorted by offset.
+type LineTable []LineEntry
+
+// Line returns the source line of the instruction at offset, 0 if it's unknown.
+func (lt LineTable) Line(offset int) int {
+	i := sort.Search(len(lt), func(i int) bool { return lt[i].Offset > offset }) - 1
+	if i < 0 {
+		return 0
+	}
+	return lt[i].Line
+}
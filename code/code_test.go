@@ -7,8 +7,9 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpAdd),
 		Make(Opconst, 2),
 		Make(Opconst, 65534),
+		Make(OpCall, 255),
 	}
-	expected := "0x0000 OpAdd\n0x0001 OpConstant 2\n0x0004 OpConstant 65534\n"
+	expected := "0x0000 OpAdd\n0x0001 OpConstant 2\n0x0004 OpConstant 65534\n0x0007 OpCall 255\n"
 
 	concatted := Instructions{}
 	for _, ins := range instructions {
@@ -18,3 +19,26 @@ func TestInstructionsString(t *testing.T) {
 		t.Errorf("instructions wrongly formatted:\n wanted:\n%s got:\n%s", expected, concatted.String())
 	}
 }
+
+func TestLineTable(t *testing.T) {
+	lines := LineTable{{Offset: 0, Line: 1}, {Offset: 4, Line: 3}, {Offset: 9, Line: 2}}
+	tests := []struct {
+		offset   int
+		expected int
+	}{
+		{0, 1},
+		{3, 1},
+		{4, 3},
+		{8, 3},
+		{9, 2},
+		{100, 2},
+	}
+	for _, tt := range tests {
+		if line := lines.Line(tt.offset); line != tt.expected {
+			t.Errorf("wrong line of offset %d. want=%d, got=%d", tt.offset, tt.expected, line)
+		}
+	}
+	if line := (LineTable{}).Line(0); line != 0 {
+		t.Errorf("wrong line in empty table. want=0, got=%d", line)
+	}
+}
@@ -19,17 +19,39 @@ type Compiler struct {
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
 	symbolTable         *SymbolTable
+	// hoisted holds the names of top level functions that are defined before their let statement is compiled
+	hoisted map[string]bool
+	// loops is the stack of the loops enclosing the code being compiled, innermost last
+	loops []*loop
+	// blocks is the number of blocks, e.g. loop bodies, nested in the program or function body being
+	// compiled. Like in the evaluator, a let in a nested block assigns a name already defined.
+	blocks int
+	// line is the source line of the node being compiled, lines maps the emitted instructions to their lines
+	line  int
+	lines code.LineTable
+}
+
+// loop collects the jumps of break and continue statements, they are patched once the
+// positions they jump to are known.
+type loop struct {
+	breaks    []int
+	continues []int
 }
 
 var symbol_table = map[string]int{}
 
 func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, b := range object.Builtins {
+		symbolTable.DefineBuiltin(i, b.Name)
+	}
 	return &Compiler{
 		instructions:        code.Instructions{},
 		constants:           []object.Object{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
-		symbolTable:         NewSymbolTable(),
+		symbolTable:         symbolTable,
+		hoisted:             map[string]bool{},
 	}
 }
 
@@ -42,8 +64,14 @@ func NewWithState(st *SymbolTable, constants []object.Object) *Compiler {
 }
 
 func (c *Compiler) Compile(node ast.Node, depth int) error {
+	// nodes without a position, e.g. an empty program, keep the line of the enclosing node
+	if line := node.Pos().Line; line > 0 {
+		defer func(enclosingLine int) { c.line = enclosingLine }(c.line)
+		c.line = line
+	}
 	switch node := node.(type) {
 	case *ast.Program:
+		c.hoistFunctionNames(node.Statements)
 		for _, s := range node.Statements {
 			err := c.Compile(s, depth)
 			if err != nil {
@@ -51,6 +79,8 @@ func (c *Compiler) Compile(node ast.Node, depth int) error {
 			}
 		}
 	case *ast.BlockStatement:
+		c.blocks++
+		defer func() { c.blocks-- }()
 		for _, s := range node.Statements {
 			err := c.Compile(s, depth)
 			if err != nil {
@@ -60,24 +90,77 @@ func (c *Compiler) Compile(node ast.Node, depth int) error {
 	case *ast.FunctionLiteral:
 		c_func := NewWithState(c.symbolTable, c.constants)
 		c_func.symbolTable = NewSymbolTableWithUpper(c.symbolTable)
-		err := c_func.Compile(node.Body, depth+1)
-		if err != nil {
-			return err
+		c_func.line = c.line
+		// a global function refers to itself through its global, which may be reassigned
+		if node.Name != "" && c.symbolTable.upper != nil {
+			c_func.symbolTable.DefineFunctionName(node.Name)
+		}
+		for _, param := range node.Parameters {
+			c_func.symbolTable.Define(param.Value)
+		}
+		// the statements of the body are compiled directly, the body isn't a nested block
+		for _, s := range node.Body.Statements {
+			err := c_func.Compile(s, depth+1)
+			if err != nil {
+				return err
+			}
 		}
 		// @Problem: what if the last instruction is a let statement?
 		if c_func.lastInstructionIsPop() {
 			c_func.removeLastPop()
+			// the implicit return belongs to the line of the returned expression
+			c_func.line = 0
 			c_func.emit(code.OpReturnValue)
 		}
 		if !c_func.lastInstructionIsReturnValue() {
+			c_func.line = node.Body.End().Line
 			c_func.emit(code.OpReturn)
 		}
 		// constants are moved back
 		// @Optimize: this copying is not efficient, we can use address instead
 		c.constants = c_func.constants
-		compiledFunc := &object.CompiledFunction{Instructions: c_func.instructions}
+		// push the cells of the captured variables, they are resolved in the enclosing scope
+		freeSymbols := c_func.symbolTable.FreeSymbols
+		for _, sbl := range freeSymbols {
+			c.captureSymbol(sbl)
+		}
+		compiledFunc := &object.CompiledFunction{
+			Instructions:  c_func.instructions,
+			NumParameters: len(node.Parameters),
+			NumLocals:     c_func.symbolTable.numDefinitions,
+			Name:          node.Name,
+			Lines:         c_func.lines,
+		}
 		index := c.addConstant(compiledFunc)
-		c.emit(code.Opconst, index)
+		c.emit(code.OpClosure, index, len(freeSymbols))
+	case *ast.WhileStatement:
+		loopStart := len(c.instructions)
+		err := c.Compile(node.Condition, depth)
+		if err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+		err = c.compileLoopBody(node.Body, depth, loopStart, jumpNotTruthyPos)
+		if err != nil {
+			return err
+		}
+	case *ast.ForInStatement:
+		err := c.compileForIn(node, depth)
+		if err != nil {
+			return err
+		}
+	case *ast.BreakStatement:
+		if len(c.loops) == 0 {
+			return fmt.Errorf("break outside of a loop")
+		}
+		l := c.loops[len(c.loops)-1]
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+	case *ast.ContinueStatement:
+		if len(c.loops) == 0 {
+			return fmt.Errorf("continue outside of a loop")
+		}
+		l := c.loops[len(c.loops)-1]
+		l.continues = append(l.continues, c.emit(code.OpJump, 9999))
 	case *ast.ReturnStatement:
 		err := c.Compile(node.ReturnValue, depth)
 		if err != nil {
@@ -85,41 +168,53 @@ func (c *Compiler) Compile(node ast.Node, depth int) error {
 		}
 		c.emit(code.OpReturnValue)
 	case *ast.CallExpression:
+		// the number of arguments is a one byte operand
+		if len(node.Arguments) > 255 {
+			return fmt.Errorf("too many arguments: %d, a call takes at most 255", len(node.Arguments))
+		}
 		err := c.Compile(node.Function, depth)
 		if err != nil {
 			return err
 		}
-		c.emit(code.OpCall)
+		for _, arg := range node.Arguments {
+			err := c.Compile(arg, depth)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
 	case *ast.LetStatement:
+		// a global function, also one bound in a nested block, is defined before its body is compiled
+		if c.symbolTable.upper == nil {
+			c.hoistFunctionNames([]ast.Statement{node})
+		}
 		err := c.Compile(node.Value, depth)
 		if err != nil {
 			return err
 		}
-		_, ok := c.symbolTable.Resolve(node.Name.Value)
-		if ok {
-			return fmt.Errorf("%s is already defined", node.Name.Value)
-		}
-		symbol := c.symbolTable.Define(node.Name.Value)
-		var opcode code.Opcode
-		if symbol.Scope == GlobalScope {
-			opcode = code.OpSetGlobal
+		// shadowing a name of an enclosing scope is fine
+		symbol, ok := c.symbolTable.ResolveLocal(node.Name.Value)
+		if ok && c.hoisted[node.Name.Value] {
+			delete(c.hoisted, node.Name.Value)
+		} else if ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+			if c.blocks == 0 {
+				return fmt.Errorf("%s is already defined", node.Name.Value)
+			}
 		} else {
-			opcode = code.OpSetLocal
+			symbol = c.symbolTable.Define(node.Name.Value)
 		}
-		c.emit(opcode, symbol.Index)
+		c.storeSymbol(symbol)
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
-		var opcode code.Opcode
 		if !ok {
 			return fmt.Errorf("undefined variable: %s", node.Value)
 		}
-		if symbol.Scope == GlobalScope {
-			opcode = code.OpGetGlobal
-		} else {
-			opcode = code.OpGetLocal
+		c.loadSymbol(symbol)
+	case *ast.AssignExpression:
+		err := c.compileAssign(node, depth)
+		if err != nil {
+			return err
 		}
-		c.emit(opcode, symbol.Index)
-	// @TODO: we need an assignment statement
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression, depth)
 		if err != nil {
@@ -140,6 +235,9 @@ func (c *Compiler) Compile(node ast.Node, depth int) error {
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogical(node, depth)
+		}
 		err := c.Compile(node.Left, depth)
 		if err != nil {
 			return err
@@ -157,10 +255,16 @@ func (c *Compiler) Compile(node ast.Node, depth int) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
 		case ">":
 			c.emit(code.OpGreaterThan)
 		case "<":
 			c.emit(code.OpLessThan)
+		case ">=":
+			c.emit(code.OpGreaterEqual)
+		case "<=":
+			c.emit(code.OpLessEqual)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
@@ -169,9 +273,15 @@ func (c *Compiler) Compile(node ast.Node, depth int) error {
 			return fmt.Errorf("operator not support: %s", node.Operator)
 		}
 	case *ast.IntegerLiteral:
-		integer := &object.Integer{Value: node.Value}
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInt{Value: node.Big}
+		}
 		integer_index := c.addConstant(integer)
 		c.emit(code.Opconst, integer_index)
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.Opconst, c.addConstant(float))
 	case *ast.BooleanLiteral:
 		if node.Value {
 			c.emit(code.OpTrue)
@@ -194,9 +304,7 @@ func (c *Compiler) Compile(node ast.Node, depth int) error {
 		if err != nil {
 			return err
 		}
-		if c.lastInstructionIsPop() {
-			c.removeLastPop()
-		}
+		c.keepBlockValue()
 		ins_jumpOverAltPos = c.emit(code.OpJump, 999)
 		// now modify the jump position
 		afterConsequencePos := len(c.instructions)
@@ -208,9 +316,7 @@ func (c *Compiler) Compile(node ast.Node, depth int) error {
 			if err != nil {
 				return err
 			}
-			if c.lastInstructionIsPop() {
-				c.removeLastPop()
-			}
+			c.keepBlockValue()
 		}
 		// now modify the jump position
 		afterAltenativePos := len(c.instructions)
@@ -223,6 +329,44 @@ func (c *Compiler) Compile(node ast.Node, depth int) error {
 			}
 		}
 		c.emit(code.OpArray, len(node.Elements))
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			err := c.Compile(part, depth)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpBuildString, len(node.Parts))
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left, depth)
+		if err != nil {
+			return err
+		}
+		// an omitted bound is passed as null
+		for _, bound := range []ast.Expression{node.Low, node.High} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			err = c.Compile(bound, depth)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
+	case *ast.HashLiteral:
+		// the parser stores the pairs in a map, the keys are compiled in source order
+		for _, k := range node.Keys() {
+			err := c.Compile(k, depth)
+			if err != nil {
+				return err
+			}
+			err = c.Compile(node.Pairs[k], depth)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
 	case *ast.ArrayAccessExpression:
 		err := c.Compile(node.Array, depth)
 		if err != nil {
@@ -237,6 +381,273 @@ func (c *Compiler) Compile(node ast.Node, depth int) error {
 	return nil
 }
 
+// keepBlockValue leaves the value of the block just compiled on the stack: the value of its last
+// expression statement, or null if the block doesn't end with one.
+func (c *Compiler) keepBlockValue() {
+	if c.lastInstructionIsPop() {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+}
+
+// compileLoopBody compiles the body of a loop starting at loopStart, whose condition ends with
+// the OpJumpNotTruthy at exitJumpPos. continue statements jump back to loopStart.
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement, depth int, loopStart int, exitJumpPos int) error {
+	l := &loop{}
+	c.loops = append(c.loops, l)
+	err := c.Compile(body, depth)
+	c.loops = c.loops[:len(c.loops)-1]
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpJump, loopStart)
+	loopEnd := len(c.instructions)
+	c.changeOperand(exitJumpPos, loopEnd)
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, loopEnd)
+	}
+	for _, pos := range l.continues {
+		c.changeOperand(pos, loopStart)
+	}
+	return nil
+}
+
+// compileForIn compiles for (x in iterable) { body } like
+//
+//	let $iter0 = iterable; let $i0 = 0;
+//	while ($i0 < len($iter0)) { x = $iter0[$i0]; $i0 = $i0 + 1; body }
+//
+// the hidden variables can't clash with user code since '$' is not part of identifiers, they are
+// numbered by the nesting of the loop so that sibling loops share them and nested loops don't.
+func (c *Compiler) compileForIn(node *ast.ForInStatement, depth int) error {
+	err := c.Compile(node.Iterable, depth)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpCheckIterable)
+	iter := c.hiddenSymbol(fmt.Sprintf("$iter%d", len(c.loops)))
+	c.storeSymbol(iter)
+	index := c.hiddenSymbol(fmt.Sprintf("$i%d", len(c.loops)))
+	c.emit(code.Opconst, c.addConstant(&object.Integer{Value: 0}))
+	c.storeSymbol(index)
+	variable, ok := c.symbolTable.ResolveLocal(node.Variable.Value)
+	if !ok || (variable.Scope != GlobalScope && variable.Scope != LocalScope) {
+		variable = c.symbolTable.Define(node.Variable.Value)
+	}
+
+	loopStart := len(c.instructions)
+	c.loadSymbol(index)
+	c.emit(code.OpGetBuiltin, builtinIndex("len"))
+	c.loadSymbol(iter)
+	c.emit(code.OpCall, 1)
+	c.emit(code.OpLessThan)
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	c.loadSymbol(iter)
+	c.loadSymbol(index)
+	c.emit(code.OpIndex)
+	c.storeSymbol(variable)
+	// the index is advanced before the body, so continue can jump straight back to the condition
+	c.loadSymbol(index)
+	c.emit(code.Opconst, c.addConstant(&object.Integer{Value: 1}))
+	c.emit(code.OpAdd)
+	c.storeSymbol(index)
+
+	return c.compileLoopBody(node.Body, depth, loopStart, jumpNotTruthyPos)
+}
+
+// compileLogical compiles && and || so that the right operand is only evaluated when it decides
+// the result. The result is always a boolean, the right operand is turned into one with two OpBang.
+func (c *Compiler) compileLogical(node *ast.InfixExpression, depth int) error {
+	err := c.Compile(node.Left, depth)
+	if err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if node.Operator == "||" {
+		c.emit(code.OpTrue)
+		jumpToEndPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.instructions))
+		err = c.Compile(node.Right, depth)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpBang)
+		c.emit(code.OpBang)
+		c.changeOperand(jumpToEndPos, len(c.instructions))
+		return nil
+	}
+	err = c.Compile(node.Right, depth)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	jumpToEndPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.instructions))
+	c.emit(code.OpFalse)
+	c.changeOperand(jumpToEndPos, len(c.instructions))
+	return nil
+}
+
+var binaryOpcodes = map[string]code.Opcode{
+	"+": code.OpAdd,
+	"-": code.OpSub,
+	"*": code.OpMul,
+	"/": code.OpDiv,
+}
+
+// compileAssign leaves the assigned value on the stack, as assignments are expressions.
+func (c *Compiler) compileAssign(node *ast.AssignExpression, depth int) error {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable: %s", target.Value)
+		}
+		switch symbol.Scope {
+		case GlobalScope, LocalScope, FreeScope:
+		default:
+			return fmt.Errorf("cannot assign to %s", target.Value)
+		}
+		if node.BinaryOperator() != "" {
+			c.loadSymbol(symbol)
+		}
+		err := c.compileAssignedValue(node, depth)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+		c.loadSymbol(symbol)
+	case *ast.ArrayAccessExpression:
+		err := c.Compile(target.Array, depth)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(target.Index, depth)
+		if err != nil {
+			return err
+		}
+		if node.BinaryOperator() != "" {
+			// keep the container and the index in hidden variables, so they are evaluated only once
+			index := c.hiddenSymbol("$index")
+			c.storeSymbol(index)
+			container := c.hiddenSymbol("$container")
+			c.storeSymbol(container)
+			c.loadSymbol(container)
+			c.loadSymbol(index)
+			c.loadSymbol(container)
+			c.loadSymbol(index)
+			c.emit(code.OpIndex)
+		}
+		err = c.compileAssignedValue(node, depth)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex)
+	default:
+		return fmt.Errorf("invalid assignment target: %s", node.Target)
+	}
+	return nil
+}
+
+// compileAssignedValue compiles the value of the assignment, for a compound assignment
+// the current value of the target is expected on the stack.
+func (c *Compiler) compileAssignedValue(node *ast.AssignExpression, depth int) error {
+	err := c.Compile(node.Value, depth)
+	if err != nil {
+		return err
+	}
+	if op := node.BinaryOperator(); op != "" {
+		opcode, ok := binaryOpcodes[op]
+		if !ok {
+			return fmt.Errorf("operator not support: %s", node.Operator)
+		}
+		c.emit(opcode)
+	}
+	return nil
+}
+
+func builtinIndex(name string) int {
+	for i, b := range object.Builtins {
+		if b.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// hiddenSymbol returns the hidden variable name of the current scope, it's defined on first use
+// and then reused, so that the hidden variables don't use up the local slots.
+func (c *Compiler) hiddenSymbol(name string) Symbol {
+	if sbl, ok := c.symbolTable.ResolveLocal(name); ok {
+		return sbl
+	}
+	return c.symbolTable.Define(name)
+}
+
+// captureSymbol pushes the cell of a variable captured by a closure being created. Locals are
+// captured by reference, so the closure sees later assignments and its own assignments are seen
+// by the enclosing function.
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpGetLocalCell, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFreeCell, s.Index)
+	default:
+		// the name of the enclosing function can't be assigned, it's captured by value
+		c.loadSymbol(s)
+	}
+}
+
+// hoistFunctionNames defines the names of all functions bound by the given top level let
+// statements up front, so these functions can reference each other regardless of their order.
+func (c *Compiler) hoistFunctionNames(statements []ast.Statement) {
+	for _, s := range statements {
+		let, ok := s.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); !ok {
+			continue
+		}
+		// builtins may be shadowed
+		if sbl, ok := c.symbolTable.ResolveLocal(let.Name.Value); ok && sbl.Scope != BuiltinScope {
+			continue
+		}
+		c.symbolTable.Define(let.Name.Value)
+		c.hoisted[let.Name.Value] = true
+	}
+}
+
 func (c *Compiler) addConstant(obj object.Object) int {
 	c.constants = append(c.constants, obj)
 	return len(c.constants) - 1
@@ -252,10 +663,24 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 
 func (c *Compiler) addInstruction(ins []byte) int {
 	newInstructionPos := len(c.instructions)
+	c.addLine(newInstructionPos)
 	c.instructions = append(c.instructions, ins...)
 	return newInstructionPos
 }
 
+// addLine records that the instruction at pos belongs to the current line.
+func (c *Compiler) addLine(pos int) {
+	n := len(c.lines)
+	if c.line == 0 || (n > 0 && c.lines[n-1].Line == c.line) {
+		return
+	}
+	if n > 0 && c.lines[n-1].Offset == pos {
+		c.lines[n-1].Line = c.line
+		return
+	}
+	c.lines = append(c.lines, code.LineEntry{Offset: pos, Line: c.line})
+}
+
 func (c *Compiler) lastInstructionIsPop() bool {
 	return c.lastInstruction.Opcode == code.OpPop
 }
@@ -267,6 +692,9 @@ func (c *Compiler) lastInstructionIsReturnValue() bool {
 func (c *Compiler) removeLastPop() {
 	c.instructions = c.instructions[:c.lastInstruction.Position]
 	c.lastInstruction = c.previousInstruction
+	for n := len(c.lines); n > 0 && c.lines[n-1].Offset >= len(c.instructions); n-- {
+		c.lines = c.lines[:n-1]
+	}
 }
 
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
@@ -285,10 +713,17 @@ func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.instructions,
 		Constants:    c.constants,
+		Lines:        c.lines,
+		GlobalNames:  c.symbolTable.DefinedNames(),
 	}
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	// Lines maps the top level instructions to source lines
+	Lines code.LineTable
+	// GlobalNames are the names of the globals by index, a global read before its let statement
+	// ran is reported by name
+	GlobalNames []string
 }
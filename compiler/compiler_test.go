@@ -7,6 +7,8 @@ import (
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -78,6 +80,20 @@ func TestStringExpressions(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             `"a${1}b${2 + 3}"`,
+			expectedConstants: []interface{}{"a", 1, "b", 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.Opconst, 2),
+				code.Make(code.Opconst, 3),
+				code.Make(code.Opconst, 4),
+				code.Make(code.OpAdd),
+				code.Make(code.OpBuildString, 4),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -124,6 +140,26 @@ func TestIntegerArithmetic(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "1%2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1.5 * 2",
+			expectedConstants: []interface{}{1.5, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+			},
+		},
 		{
 			input:             "true",
 			expectedConstants: []any{},
@@ -181,6 +217,26 @@ func TestIntegerArithmetic(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "1 >= 2",
+			expectedConstants: []any{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.OpGreaterEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 <= 2",
+			expectedConstants: []any{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.OpLessEqual),
+				code.Make(code.OpPop),
+			},
+		},
 		{
 			input:             "true != false",
 			expectedConstants: []any{},
@@ -305,7 +361,7 @@ func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 }
 
 func parse(input string) *ast.Program {
-	l := lexer.New(input)
+	l := lexer.New("", input)
 	p := parser.New(l)
 	return p.ParseProgram()
 }
@@ -342,6 +398,11 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 			if err != nil {
 				return fmt.Errorf("%dth constant testIntegerObject failed: %s", i, err)
 			}
+		case float64:
+			err := testFloatObject(cons, actual[i])
+			if err != nil {
+				return fmt.Errorf("%dth constant testFloatObject failed: %s", i, err)
+			}
 		case string:
 			err := testStringObject(string(cons), actual[i])
 			if err != nil {
@@ -361,6 +422,17 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("not expected float number: expect=%g, got=%g", expected, result.Value)
+	}
+	return nil
+}
+
 func testIntegerObject(expected int64, actual object.Object) error {
 	result, ok := actual.(*object.Integer)
 	if !ok {
@@ -400,7 +472,7 @@ func TestFunctions(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.Opconst, 2),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -417,7 +489,7 @@ func TestFunctions(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.Opconst, 2),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -435,7 +507,7 @@ func TestFunctionsWithoutReturnValue(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.Opconst, 0),
+				code.Make(code.OpClosure, 0, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -455,8 +527,8 @@ func TestFunctionCalls(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.Opconst, 1), // The compiled function
-				code.Make(code.OpCall),
+				code.Make(code.OpClosure, 1, 0), // The compiled function
+				code.Make(code.OpCall, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -471,10 +543,62 @@ func TestFunctionCalls(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.Opconst, 1), // The compiled function
+				code.Make(code.OpClosure, 1, 0), // The compiled function
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestFunctionCallsWithArguments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `let oneArg = fn(a) { a };
+					oneArg(24);`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				24,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let manyArg = fn(a, b, c) { a; b; c };
+					manyArg(24, 25, 26);`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpReturnValue),
+				},
+				24,
+				25,
+				26,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpCall),
+				code.Make(code.Opconst, 1),
+				code.Make(code.Opconst, 2),
+				code.Make(code.Opconst, 3),
+				code.Make(code.OpCall, 3),
 				code.Make(code.OpPop),
 			},
 		},
@@ -499,7 +623,7 @@ func TestLetStatementScopes(t *testing.T) {
 			expectedInstructions: []code.Instructions{
 				code.Make(code.Opconst, 0),
 				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.Opconst, 1),
+				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -520,7 +644,7 @@ num
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.Opconst, 1),
+				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -547,10 +671,662 @@ a + b
 				},
 			},
 			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+fn(a) {
+	fn(b) {
+		a + b
+	}
+}
+`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+fn(a) {
+	fn(b) {
+		fn(c) {
+			a + b + c
+		}
+	}
+};
+`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 0, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { let n = 0; fn() { n += 1 } }`,
+			expectedConstants: []interface{}{
+				0,
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.Opconst, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpSetFree, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.Opconst, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+let countDown = fn(x) { countDown(x - 1); };
+countDown(1);
+`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.Opconst, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.Opconst, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+let wrapper = fn() {
+	let countDown = fn(x) { countDown(x - 1); };
+	countDown(1);
+};
+wrapper();
+`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.Opconst, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.Opconst, 2),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestMutuallyRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+let isEven = fn(n) { isOdd(n) };
+let isOdd = fn(n) { isEven(n) };
+`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2, 3: 4, 5: 6}",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.Opconst, 2),
+				code.Make(code.Opconst, 3),
+				code.Make(code.Opconst, 4),
+				code.Make(code.Opconst, 5),
+				code.Make(code.OpHash, 6),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{5: 6, 1: 2, 3: 4}",
+			expectedConstants: []interface{}{5, 6, 1, 2, 3, 4},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.Opconst, 2),
+				code.Make(code.Opconst, 3),
+				code.Make(code.Opconst, 4),
+				code.Make(code.Opconst, 5),
+				code.Make(code.OpHash, 6),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2 + 3, 4: 5 * 6}",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.Opconst, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.Opconst, 3),
+				code.Make(code.Opconst, 4),
+				code.Make(code.Opconst, 5),
+				code.Make(code.OpMul),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1, 2, 3][1]",
+			expectedConstants: []interface{}{1, 2, 3, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.Opconst, 2),
+				code.Make(code.OpArray, 3),
+				code.Make(code.Opconst, 3),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2, 3][1 + 1]",
+			expectedConstants: []interface{}{1, 2, 3, 1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.Opconst, 2),
+				code.Make(code.OpArray, 3),
+				code.Make(code.Opconst, 3),
+				code.Make(code.Opconst, 4),
+				code.Make(code.OpAdd),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2}[1]",
+			expectedConstants: []interface{}{1, 2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.OpHash, 2),
+				code.Make(code.Opconst, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+len([]);
+push([], 1);
+`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetBuiltin, 5),
+				code.Make(code.OpArray, 0),
+				code.Make(code.Opconst, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { len([]) }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpArray, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1, 2, 3][1:2]",
+			expectedConstants: []interface{}{1, 2, 3, 1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.Opconst, 2),
+				code.Make(code.OpArray, 3),
+				code.Make(code.Opconst, 3),
+				code.Make(code.Opconst, 4),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"monkey"[:2]`,
+			expectedConstants: []interface{}{"monkey", 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.OpNull),
+				code.Make(code.Opconst, 1),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"monkey"[1:]`,
+			expectedConstants: []interface{}{"monkey", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.OpNull),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"monkey"[:]`,
+			expectedConstants: []interface{}{"monkey"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpNull),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "while (true) { 1; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 11), // 0001
+				code.Make(code.Opconst, 0),          // 0004
+				code.Make(code.OpPop),               // 0007
+				code.Make(code.OpJump, 0),           // 0008
+			},
+		},
+		{
+			input:             "while (true) { if (false) { break; } continue; }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 23), // 0001
+				code.Make(code.OpFalse),             // 0004
+				code.Make(code.OpJumpNotTruthy, 15), // 0005
+				code.Make(code.OpJump, 23),          // 0008
+				code.Make(code.OpNull),              // 000B
+				code.Make(code.OpJump, 16),          // 000C
+				code.Make(code.OpNull),              // 000F
+				code.Make(code.OpPop),               // 0010
+				code.Make(code.OpJump, 0),           // 0011
+				code.Make(code.OpJump, 0),           // 0014
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestLoopControlOutsideLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "break outside of a loop"},
+		{"continue;", "continue outside of a loop"},
+		{"while (true) { fn() { break; } }", "break outside of a loop"},
+	}
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input), 0)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong compiler error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let a = 1; a = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { let a = 1; a += 2; }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.Opconst, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.Opconst, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let a = [1]; a[0] = 2;",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.Opconst, 2),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let a = [1]; a[0] *= 2;",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Opconst, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.Opconst, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpGetGlobal, 2),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpGetGlobal, 2),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpIndex),
 				code.Make(code.Opconst, 2),
+				code.Make(code.OpMul),
+				code.Make(code.OpSetIndex),
 				code.Make(code.OpPop),
 			},
 		},
 	}
 	runCompilerTests(t, tests)
 }
+
+func TestHiddenVariablesAreReused(t *testing.T) {
+	input := "fn() { let a = [0]; a[0] += 1; a[0] -= 1; a[0] *= 2 }"
+	compiler := New()
+	if err := compiler.Compile(parse(input), 0); err != nil {
+		t.Fatalf("compiler error %s", err)
+	}
+	constants := compiler.Bytecode().Constants
+	fn, ok := constants[len(constants)-1].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("last constant is not a function. got=%T", constants[len(constants)-1])
+	}
+	// a, $index and $container
+	if fn.NumLocals != 3 {
+		t.Errorf("wrong number of locals. want=3, got=%d", fn.NumLocals)
+	}
+}
+
+func TestInvalidAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a = 1;", "undefined variable: a"},
+		{"len = 1;", "cannot assign to len"},
+		{"fn() { let f = fn() { f = 1 } }", "cannot assign to f"},
+	}
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input), 0)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong compiler error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestTooManyArguments(t *testing.T) {
+	args := "1" + strings.Repeat(", 1", 254)
+	if err := New().Compile(parse("fn() {}("+args+")"), 0); err != nil {
+		t.Fatalf("compiler error %s", err)
+	}
+	err := New().Compile(parse("fn() {}("+args+", 1)"), 0)
+	if err == nil || err.Error() != "too many arguments: 256, a call takes at most 255" {
+		t.Errorf("wrong compiler error: want=%q, got=%v", "too many arguments: 256, a call takes at most 255", err)
+	}
+}
+
+func TestRedefinitions(t *testing.T) {
+	for _, input := range []string{"let a = 1; let a = 2;", "fn() { let a = 1; let a = 2; }"} {
+		err := New().Compile(parse(input), 0)
+		if err == nil || err.Error() != "a is already defined" {
+			t.Errorf("%s: wrong compiler error: want=%q, got=%v", input, "a is already defined", err)
+		}
+	}
+	// a let in a nested block assigns the variable
+	for _, input := range []string{"let a = 1; if (true) { let a = 2; }", "fn() { let a = 1; while (a < 2) { let a = 2; } }"} {
+		if err := New().Compile(parse(input), 0); err != nil {
+			t.Errorf("%s: compiler error %s", input, err)
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 10), // 0001
+				code.Make(code.OpFalse),             // 0004
+				code.Make(code.OpBang),              // 0005
+				code.Make(code.OpBang),              // 0006
+				code.Make(code.OpJump, 11),          // 0007
+				code.Make(code.OpFalse),             // 000A
+				code.Make(code.OpPop),               // 000B
+			},
+		},
+		{
+			input:             "true || false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 8), // 0001
+				code.Make(code.OpTrue),             // 0004
+				code.Make(code.OpJump, 11),         // 0005
+				code.Make(code.OpFalse),            // 0008
+				code.Make(code.OpBang),             // 0009
+				code.Make(code.OpBang),             // 000A
+				code.Make(code.OpPop),              // 000B
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestLineTables(t *testing.T) {
+	input := `let a = 1;
+let f = fn(x) {
+  let y = x *
+    2;
+  y
+};
+f(a)`
+	compiler := New()
+	err := compiler.Compile(parse(input), 0)
+	if err != nil {
+		t.Fatalf("compiler error %s", err)
+	}
+	bytecode := compiler.Bytecode()
+	// 0000 OpConstant 0, 0003 OpSetGlobal 0 | 0006 OpClosure 2 0, 0010 OpSetGlobal 1
+	// | 0013 OpGetGlobal 1, 0016 OpGetGlobal 0, 0019 OpCall 1, 0021 OpPop
+	expectedMain := code.LineTable{{Offset: 0, Line: 1}, {Offset: 6, Line: 2}, {Offset: 13, Line: 7}}
+	if !reflect.DeepEqual(bytecode.Lines, expectedMain) {
+		t.Errorf("wrong main line table. want=%v, got=%v", expectedMain, bytecode.Lines)
+	}
+
+	fn, ok := bytecode.Constants[2].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 2 is not a function: %T", bytecode.Constants[2])
+	}
+	if fn.Name != "f" {
+		t.Errorf("wrong function name. want=%q, got=%q", "f", fn.Name)
+	}
+	// 0000 OpGetLocal 0 | 0002 OpConstant 1 | 0005 OpMul | 0006 OpSetLocal 1
+	// | 0008 OpGetLocal 1, 0010 OpReturnValue
+	expectedFn := code.LineTable{{Offset: 0, Line: 3}, {Offset: 2, Line: 4}, {Offset: 5, Line: 3}, {Offset: 8, Line: 5}}
+	if !reflect.DeepEqual(fn.Lines, expectedFn) {
+		t.Errorf("wrong function line table. want=%v, got=%v", expectedFn, fn.Lines)
+	}
+}
@@ -3,8 +3,12 @@ package compiler
 type SymbolScope string
 
 const (
-	GlobalScope SymbolScope = "GLOBAL"
-	LocalScope  SymbolScope = "LOCAL"
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	FreeScope    SymbolScope = "FREE"
+	BuiltinScope SymbolScope = "BUILTIN"
+	// FunctionScope is the scope of the name a function is bound to, as seen from inside its own body
+	FunctionScope SymbolScope = "FUNCTION"
 )
 
 type Symbol struct {
@@ -17,6 +21,9 @@ type SymbolTable struct {
 	store          map[string]Symbol
 	numDefinitions int
 	upper          *SymbolTable
+	// FreeSymbols holds the original symbols (as resolved in the upper tables) of
+	// all free variables referenced in this scope, FreeSymbols[i] is captured as free variable i.
+	FreeSymbols []Symbol
 }
 
 func NewSymbolTable() *SymbolTable {
@@ -43,12 +50,40 @@ func (s *SymbolTable) Define(name string) Symbol {
 	return sbl
 }
 
+// DefineBuiltin defines the builtin at the given index of object.Builtins.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	sbl := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.store[name] = sbl
+	return sbl
+}
+
+// DefineFunctionName defines the name of the function this table belongs to. It doesn't take
+// a local slot, references to it are resolved to the currently executing closure.
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	sbl := Symbol{Name: name, Scope: FunctionScope, Index: 0}
+	s.store[name] = sbl
+	return sbl
+}
+
+// Resolve looks the name up in this table and then in the upper ones. A local symbol found
+// in an upper (function) scope is turned into a free symbol of this scope.
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	sbl, ok := s.store[name]
-	if !ok && s.upper != nil {
-		return s.upper.Resolve(name)
+	if ok || s.upper == nil {
+		return sbl, ok
 	}
-	return sbl, ok
+	sbl, ok = s.upper.Resolve(name)
+	if !ok || sbl.Scope == GlobalScope || sbl.Scope == BuiltinScope {
+		return sbl, ok
+	}
+	return s.defineFree(sbl), true
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+	sbl := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.store[sbl.Name] = sbl
+	return sbl
 }
 
 func (s *SymbolTable) ResolveGlobal(name string) (Symbol, bool) {
@@ -60,6 +95,17 @@ func (s *SymbolTable) ResolveGlobal(name string) (Symbol, bool) {
 	return sbl, ok
 }
 
+// DefinedNames returns the names of the variables defined in this table by their index.
+func (s *SymbolTable) DefinedNames() []string {
+	names := make([]string, s.numDefinitions)
+	for _, sbl := range s.store {
+		if sbl.Scope == GlobalScope || sbl.Scope == LocalScope {
+			names[sbl.Index] = sbl.Name
+		}
+	}
+	return names
+}
+
 func (s *SymbolTable) ResolveLocal(name string) (Symbol, bool) {
 	sbl, ok := s.store[name]
 	return sbl, ok
@@ -37,3 +37,95 @@ func TestResolveGlobal(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewSymbolTableWithUpper(global)
+	firstLocal.Define("b")
+
+	secondLocal := NewSymbolTableWithUpper(firstLocal)
+	secondLocal.Define("c")
+
+	expected := []Symbol{
+		Symbol{Name: "a", Scope: GlobalScope, Index: 0},
+		Symbol{Name: "b", Scope: FreeScope, Index: 0},
+		Symbol{Name: "c", Scope: LocalScope, Index: 0},
+	}
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v",
+				sym.Name, sym, result)
+		}
+	}
+
+	expectedFree := []Symbol{
+		Symbol{Name: "b", Scope: LocalScope, Index: 0},
+	}
+	if len(secondLocal.FreeSymbols) != len(expectedFree) {
+		t.Fatalf("wrong number of free symbols. got=%d, want=%d",
+			len(secondLocal.FreeSymbols), len(expectedFree))
+	}
+	for i, sym := range expectedFree {
+		if secondLocal.FreeSymbols[i] != sym {
+			t.Errorf("wrong free symbol. got=%+v, want=%+v",
+				secondLocal.FreeSymbols[i], sym)
+		}
+	}
+}
+
+func TestResolveUnresolvableFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewSymbolTableWithUpper(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewSymbolTableWithUpper(firstLocal)
+	secondLocal.Define("e")
+
+	_, ok := secondLocal.Resolve("b")
+	if ok {
+		t.Errorf("name b resolved, but was expected not to")
+	}
+	if len(secondLocal.FreeSymbols) != 0 {
+		t.Errorf("unresolvable name defined a free symbol: %+v", secondLocal.FreeSymbols)
+	}
+}
+
+func TestDefineResolveBuiltins(t *testing.T) {
+	global := NewSymbolTable()
+	firstLocal := NewSymbolTableWithUpper(global)
+	secondLocal := NewSymbolTableWithUpper(firstLocal)
+
+	expected := []Symbol{
+		Symbol{Name: "a", Scope: BuiltinScope, Index: 0},
+		Symbol{Name: "c", Scope: BuiltinScope, Index: 1},
+		Symbol{Name: "e", Scope: BuiltinScope, Index: 2},
+	}
+	for i, v := range expected {
+		global.DefineBuiltin(i, v.Name)
+	}
+	for _, table := range []*SymbolTable{global, firstLocal, secondLocal} {
+		for _, sym := range expected {
+			result, ok := table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v",
+					sym.Name, sym, result)
+			}
+		}
+	}
+	if len(secondLocal.FreeSymbols) != 0 {
+		t.Errorf("builtins must not become free symbols: %+v", secondLocal.FreeSymbols)
+	}
+}
@@ -7,21 +7,40 @@ import (
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
+// MaxCallDepth is the number of nested function calls after which a program fails with a stack
+// overflow, like the VM does after its maximum number of frames.
+const MaxCallDepth = 1024
+
 func Eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalStatements(node.Statements, env)
+		return evalProgram(node, env)
 	case *ast.BlockStatement:
 		return evalStatements(node.Statements, env)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.BooleanLiteral:
 		if node.Value {
 			return TRUE
@@ -30,17 +49,35 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
+		if right.Type() == object.ERROR_OBJ {
+			return right
+		}
 		return evalPrefix(node.Operator, right)
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalInfix(node, env)
+		}
 		left := Eval(node.Left, env)
+		if left.Type() == object.ERROR_OBJ {
+			return left
+		}
 		right := Eval(node.Right, env)
+		if right.Type() == object.ERROR_OBJ {
+			return right
+		}
 		return evalInfix(node.Operator, left, right)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 	case *ast.ReturnStatement:
-		return &object.ReturnValue{Value: Eval(node.ReturnValue, env)}
+		val := Eval(node.ReturnValue, env)
+		if val.Type() == object.ERROR_OBJ {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.LetStatement:
@@ -59,47 +96,87 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalArrayLiteral(node, env)
 	case *ast.ArrayAccessExpression:
 		return evalArrayAccessExpression(node, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
 	default:
 		return NULL
 	}
 }
 
+// evalProgram is the safety net of the evaluator, a panic while evaluating the program is
+// turned into an error object instead of crashing the host.
+func evalProgram(program *ast.Program, env *object.Environment) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = newError("internal error: %v", r)
+		}
+	}()
+	result = escapedLoopControl(evalStatements(program.Statements, env))
+	// a return at the top level ends the program, the returned value is its result
+	if returnValue, ok := result.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+	return result
+}
+
 func evalIdentifier(ident *ast.Identifier, env *object.Environment) object.Object {
 	obj, ok := env.Get(ident.Value)
 	if ok {
 		return obj
 	}
-	obj, ok = builtinFuns[ident.Value]
-	if ok {
-		return obj
+	if builtin := object.GetBuiltinByName(ident.Value); builtin != nil {
+		return builtin
 	}
 	return newError("identifier '%s' not bind to any expression", ident.Value)
 }
 
 func evalCallExpression(call *ast.CallExpression, env *object.Environment) object.Object {
 	function := Eval(call.Function, env)
+	if function.Type() == object.ERROR_OBJ {
+		return function
+	}
 	args := evalArgs(call.Arguments, env)
 
 	switch fun := function.(type) {
-	case *object.Error:
-		return fun
 	case *object.Builtin:
-		return fun.Fn(args...)
+		if len(args) == 1 && args[0].Type() == object.ERROR_OBJ {
+			return args[0]
+		}
+		if res := fun.Fn(args...); res != nil {
+			return res
+		}
+		return NULL
 	case *object.Function:
 		if len(args) == 1 && args[0].Type() == object.ERROR_OBJ {
 			return args[0]
 		}
-		functionEnv := object.NewCloseEnvironment(env)
+		if len(args) != len(fun.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fun.Parameters), len(args))
+		}
+		// the body runs in the environment the function was defined in, so it can use and
+		// assign the variables it captured after the defining function returned
+		functionEnv := object.NewCloseEnvironment(fun.Env)
+		functionEnv.CallDepth = env.CallDepth + 1
+		if functionEnv.CallDepth > MaxCallDepth {
+			return newError("stack overflow")
+		}
 		for i, arg := range args {
 			curParam := fun.Parameters[i]
 			functionEnv.Set(curParam.String(), arg)
 		}
 		resObj := Eval(fun.Body, functionEnv)
+		if resObj == nil {
+			return NULL
+		}
 		if resObj.Type() == object.RETURN_VALUE_OBJ {
 			r, _ := resObj.(*object.ReturnValue)
 			resObj = r.Value
 		}
-		return resObj
+		return escapedLoopControl(resObj)
 	default:
 		return newError("not a function reference: %s", function.Type())
 
@@ -110,11 +187,26 @@ func evalArrayLiteral(arrayLiteral *ast.ArrayLiteral, env *object.Environment) o
 	objectElements := []object.Object{}
 	for _, exp := range arrayLiteral.Elements {
 		obj := Eval(exp, env)
+		if obj.Type() == object.ERROR_OBJ {
+			return obj
+		}
 		objectElements = append(objectElements, obj)
 	}
 	return &object.Array{Value: objectElements}
 }
 
+func evalInterpolatedString(str *ast.InterpolatedString, env *object.Environment) object.Object {
+	parts := make([]object.Object, 0, len(str.Parts))
+	for _, exp := range str.Parts {
+		obj := Eval(exp, env)
+		if obj.Type() == object.ERROR_OBJ {
+			return obj
+		}
+		parts = append(parts, obj)
+	}
+	return object.BuildString(parts)
+}
+
 func evalArgs(exps []ast.Expression, env *object.Environment) []object.Object {
 	args := []object.Object{}
 	for _, exp := range exps {
@@ -122,35 +214,253 @@ func evalArgs(exps []ast.Expression, env *object.Environment) []object.Object {
 		if obj.Type() == object.ERROR_OBJ {
 			return []object.Object{obj}
 		}
-		args = append(args, Eval(exp, env))
+		args = append(args, obj)
 	}
 	return args
 }
 
 func evalArrayAccessExpression(ac *ast.ArrayAccessExpression, env *object.Environment) object.Object {
 	tempArrayObj := Eval(ac.Array, env)
+	if tempArrayObj.Type() == object.ERROR_OBJ {
+		return tempArrayObj
+	}
 	tempIndexObj := Eval(ac.Index, env)
+	if tempIndexObj.Type() == object.ERROR_OBJ {
+		return tempIndexObj
+	}
+	return evalIndex(tempArrayObj, tempIndexObj)
+}
 
-	if tempArrayObj.Type() == object.ARRAY_OBJ && tempIndexObj.Type() == object.INTEGER_OBJ {
+func evalIndex(tempArrayObj object.Object, tempIndexObj object.Object) object.Object {
+	switch {
+	case tempArrayObj.Type() == object.ARRAY_OBJ && tempIndexObj.Type() == object.INTEGER_OBJ:
 		arrayObj, _ := tempArrayObj.(*object.Array)
 		indexObj, _ := tempIndexObj.(*object.Integer)
-		return arrayObj.Value[indexObj.Value]
+		i, ok := object.NormalizeIndex(indexObj.Value, len(arrayObj.Value))
+		if !ok {
+			return outOfRange(indexObj.Value, len(arrayObj.Value))
+		}
+		return arrayObj.Value[i]
+	case tempArrayObj.Type() == object.STRING_OBJ && tempIndexObj.Type() == object.INTEGER_OBJ:
+		strObj, _ := tempArrayObj.(*object.String)
+		indexObj, _ := tempIndexObj.(*object.Integer)
+		runes := []rune(strObj.Value)
+		i, ok := object.NormalizeIndex(indexObj.Value, len(runes))
+		if !ok {
+			return outOfRange(indexObj.Value, len(runes))
+		}
+		return &object.String{Value: string(runes[i])}
+	case tempArrayObj.Type() == object.HASH_OBJ:
+		return evalHashIndex(tempArrayObj.(*object.Hash), tempIndexObj)
+	default:
+		return newError("index operator not supported: %s[%s]", tempArrayObj.Type(), tempIndexObj.Type())
 	}
-	return newError("eval array access error: array object type: %s, index object type: %s", tempArrayObj.Type(), tempIndexObj.Type())
+}
+
+func evalAssignExpression(ae *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := ae.Target.(type) {
+	case *ast.Identifier:
+		current, ok := env.Get(target.Value)
+		if !ok {
+			return newError("undefined variable: %s", target.Value)
+		}
+		value := evalAssignedValue(ae, current, env)
+		if value.Type() == object.ERROR_OBJ {
+			return value
+		}
+		env.Assign(target.Value, value)
+		return value
+	case *ast.ArrayAccessExpression:
+		left := Eval(target.Array, env)
+		if left.Type() == object.ERROR_OBJ {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if index.Type() == object.ERROR_OBJ {
+			return index
+		}
+		var current object.Object
+		if ae.BinaryOperator() != "" {
+			current = evalIndex(left, index)
+			if current.Type() == object.ERROR_OBJ {
+				return current
+			}
+		}
+		value := evalAssignedValue(ae, current, env)
+		if value.Type() == object.ERROR_OBJ {
+			return value
+		}
+		if err := object.SetIndex(left, index, value); err != nil {
+			return newError("%s", err)
+		}
+		return value
+	default:
+		return newError("invalid assignment target: %s", ae.Target)
+	}
+}
+
+// evalAssignedValue evaluates the value of the assignment, current is the value of the target
+// before a compound assignment.
+func evalAssignedValue(ae *ast.AssignExpression, current object.Object, env *object.Environment) object.Object {
+	value := Eval(ae.Value, env)
+	if value.Type() == object.ERROR_OBJ {
+		return value
+	}
+	if op := ae.BinaryOperator(); op != "" {
+		return evalInfix(op, current, value)
+	}
+	return value
+}
+
+func evalSliceExpression(se *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(se.Left, env)
+	if left.Type() == object.ERROR_OBJ {
+		return left
+	}
+	// an omitted bound is null
+	bounds := []object.Object{NULL, NULL}
+	for i, exp := range []ast.Expression{se.Low, se.High} {
+		if exp == nil {
+			continue
+		}
+		bounds[i] = Eval(exp, env)
+		if bounds[i].Type() == object.ERROR_OBJ {
+			return bounds[i]
+		}
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		lo, hi, err := object.SliceBounds(bounds[0], bounds[1], len(left.Value))
+		if err != nil {
+			return newError("%s", err)
+		}
+		elements := make([]object.Object, hi-lo)
+		copy(elements, left.Value[lo:hi])
+		return &object.Array{Value: elements}
+	case *object.String:
+		runes := []rune(left.Value)
+		lo, hi, err := object.SliceBounds(bounds[0], bounds[1], len(runes))
+		if err != nil {
+			return newError("%s", err)
+		}
+		return &object.String{Value: string(runes[lo:hi])}
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+}
+
+func outOfRange(index int64, length int) object.Object {
+	if object.IndexOutOfRange == object.OutOfRangeError {
+		return newError("index out of range: %d (length %d)", index, length)
+	}
+	return NULL
+}
+
+func evalHashIndex(hash *object.Hash, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+	pair, ok := hash.Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+	return pair.Value
+}
+
+func evalHashLiteral(hl *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+	for _, keyNode := range hl.Keys() {
+		key := Eval(keyNode, env)
+		if key.Type() == object.ERROR_OBJ {
+			return key
+		}
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+		value := Eval(hl.Pairs[keyNode], env)
+		if value.Type() == object.ERROR_OBJ {
+			return value
+		}
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	return &object.Hash{Pairs: pairs}
 }
 
 // @TODO: block statement should also be evaluated in a closure
 func evalStatements(statements []ast.Statement, env *object.Environment) object.Object {
-	var obj object.Object
+	var obj object.Object = NULL
 	for _, st := range statements {
 		obj = Eval(st, env)
-		if obj.Type() == object.RETURN_VALUE_OBJ || obj.Type() == object.ERROR_OBJ {
+		switch obj.Type() {
+		case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
 			return obj
 		}
 	}
 	return obj
 }
 
+// escapedLoopControl reports a break or continue that reached a function or program boundary.
+func escapedLoopControl(obj object.Object) object.Object {
+	switch obj.Type() {
+	case object.BREAK_OBJ:
+		return newError("break outside of a loop")
+	case object.CONTINUE_OBJ:
+		return newError("continue outside of a loop")
+	default:
+		return obj
+	}
+}
+
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if condition.Type() == object.ERROR_OBJ {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+		res := Eval(ws.Body, env)
+		switch res.Type() {
+		case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+			return res
+		case object.BREAK_OBJ:
+			return NULL
+		}
+	}
+}
+
+func evalForInStatement(fs *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	var elements []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Error:
+		return iterable
+	case *object.Array:
+		elements = iterable.Value
+	case *object.String:
+		for _, r := range iterable.Value {
+			elements = append(elements, &object.String{Value: string(r)})
+		}
+	default:
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+	for i := 0; i < len(elements); i++ {
+		env.Set(fs.Variable.Value, elements[i])
+		res := Eval(fs.Body, env)
+		switch res.Type() {
+		case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+			return res
+		case object.BREAK_OBJ:
+			return NULL
+		}
+	}
+	return NULL
+}
+
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{ErrorMessage: fmt.Sprintf(format, a...)}
 }
@@ -160,7 +470,11 @@ func evalPrefix(operator string, right object.Object) object.Object {
 	case "!":
 		return reverseBooleanize(right)
 	case "-":
-		return negate(right)
+		res, err := object.Negate(right)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return res
 	default:
 		return newError("invalid prefix: %s", operator)
 	}
@@ -182,77 +496,53 @@ func reverseBooleanize(obj object.Object) object.Object {
 	}
 }
 
-func negate(obj object.Object) object.Object {
-	if obj.Type() != object.INTEGER_OBJ {
-		return NULL
-	}
-	val := obj.(*object.Integer).Value
-	return &object.Integer{Value: -val}
-}
-
 func evalInfix(operator string, left object.Object, right object.Object) object.Object {
-	switch {
-	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfix(operator, left, right)
-	case left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
-		return evalBooleanInfix(operator, left, right)
-	case left.Type() != right.Type():
-		return newError("mismatching type in infix:  %s %s %s",
-			left.Type(), operator, right.Type())
-	default:
-		return newError("eval infix error:  %s %s %s",
-			left.Type(), operator, right.Type())
-	}
-}
-
-func evalBooleanInfix(operator string, left object.Object, right object.Object) object.Object {
 	switch operator {
-	case "==":
-		return nativeBool2Object(left == right)
-	case "!=":
-		return nativeBool2Object(left != right)
+	case "==", "!=", "<", ">", "<=", ">=":
+		res, err := object.Compare(operator, left, right)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return nativeBool2Object(res)
 	default:
-		return newError("eval boolean infix error:  %s %s %s",
-			left.Type(), operator, right.Type())
+		res, err := object.BinaryOp(operator, left, right)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return res
 	}
 }
 
-func evalIntegerInfix(operator string, left object.Object, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-	switch operator {
-	case "==":
-		return nativeBool2Object(leftVal == rightVal)
-	case "!=":
-		return nativeBool2Object(leftVal != rightVal)
-	case "<":
-		return nativeBool2Object(leftVal < rightVal)
-	case ">":
-		return nativeBool2Object(leftVal > rightVal)
-	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
-	default:
-		return newError("eval integer infix error:  %s %s %s",
-			left.Type(), operator, right.Type())
+// evalLogicalInfix only evaluates the right operand of && and || when it decides the result.
+func evalLogicalInfix(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if left.Type() == object.ERROR_OBJ {
+		return left
 	}
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+	right := Eval(node.Right, env)
+	if right.Type() == object.ERROR_OBJ {
+		return right
+	}
+	return nativeBool2Object(isTruthy(right))
 }
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
+	if condition.Type() == object.ERROR_OBJ {
+		return condition
+	}
 	if isTruthy(condition) {
 		return Eval(ie.Consequence, env)
 	} else if ie.Altenative != nil {
 		return Eval(ie.Altenative, env)
 	} else {
-		// never happens: since the parser makes sure that the if expression has a non-nil altenative
-		return newError("altenative in ifexpression is nil",
-			condition.Type())
+		return NULL
 	}
 }
 
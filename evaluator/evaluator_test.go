@@ -0,0 +1,441 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+type evalTestCase struct {
+	input    string
+	expected any
+}
+
+func testEval(input string) object.Object {
+	l := lexer.New("", input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+	return Eval(program, env)
+}
+
+func runEvalTests(t *testing.T, tests []evalTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpectedObject(t, tt.input, tt.expected, evaluated)
+	}
+}
+
+func testExpectedObject(t *testing.T, input string, expected any, actual object.Object) {
+	t.Helper()
+	switch expected := expected.(type) {
+	case int:
+		result, ok := actual.(*object.Integer)
+		if !ok {
+			t.Errorf("%s: object is not Integer. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if result.Value != int64(expected) {
+			t.Errorf("%s: object has wrong value. want=%d, got=%d", input, expected, result.Value)
+		}
+	case *big.Int:
+		result, ok := actual.(*object.BigInt)
+		if !ok {
+			t.Errorf("%s: object is not BigInt. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if result.Value.Cmp(expected) != 0 {
+			t.Errorf("%s: object has wrong value. want=%s, got=%s", input, expected, result.Value)
+		}
+	case float64:
+		result, ok := actual.(*object.Float)
+		if !ok {
+			t.Errorf("%s: object is not Float. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if result.Value != expected {
+			t.Errorf("%s: object has wrong value. want=%g, got=%g", input, expected, result.Value)
+		}
+	case bool:
+		result, ok := actual.(*object.Boolean)
+		if !ok {
+			t.Errorf("%s: object is not Boolean. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if result.Value != expected {
+			t.Errorf("%s: object has wrong value. want=%t, got=%t", input, expected, result.Value)
+		}
+	case string:
+		result, ok := actual.(*object.String)
+		if !ok {
+			t.Errorf("%s: object is not String. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if result.Value != expected {
+			t.Errorf("%s: object has wrong value. want=%q, got=%q", input, expected, result.Value)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("%s: object is not Array. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if len(array.Value) != len(expected) {
+			t.Errorf("%s: wrong num of elements. want=%d, got=%d", input, len(expected), len(array.Value))
+			return
+		}
+		for i, expectedElem := range expected {
+			testExpectedObject(t, input, expectedElem, array.Value[i])
+		}
+	case *object.Error:
+		result, ok := actual.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if result.ErrorMessage != expected.ErrorMessage {
+			t.Errorf("%s: wrong error message. want=%q, got=%q", input, expected.ErrorMessage, result.ErrorMessage)
+		}
+	case *object.Null:
+		if actual != NULL {
+			t.Errorf("%s: object is not NULL. got=%T (%+v)", input, actual, actual)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"three": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+			continue
+		}
+		integer, ok := pair.Value.(*object.Integer)
+		if !ok || integer.Value != expectedValue {
+			t.Errorf("wrong value for key. want=%d, got=%+v", expectedValue, pair.Value)
+		}
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []evalTestCase{
+		{`{1: 5}[1]`, 5},
+		{`{1: 5}[2]`, NULL},
+		{`{}[1]`, NULL},
+		{`{1: 5, 2: 6}[2]`, 6},
+		{`{true: 5}[true]`, 5},
+		{`let key = "seven"; {"seven": 7}[key]`, 7},
+		{`{fn(x) { x }: 1}`, &object.Error{ErrorMessage: "unusable as hash key: FUNCTION"}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []evalTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len([1, 2, 3])`, 3},
+		{`len(true)`, &object.Error{ErrorMessage: "len (currently) doesn't support BOOLEAN type"}},
+		{`len("one", "two")`, &object.Error{ErrorMessage: "len(): expect 1 arguments, but got 2"}},
+		{`puts("hello")`, NULL},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, NULL},
+		{`last([1, 2, 3])`, 3},
+		{`len(rest([1, 2, 3]))`, 2},
+		{`len(push([], 1))`, 1},
+		{`first(1)`, &object.Error{ErrorMessage: "first(): argument must be ARRAY, got INTEGER"}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []evalTestCase{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1 + 1]", 3},
+		{"let arr = [1, 2, 3]; arr[len(arr) - 1]", 3},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][3]", NULL},
+		{"[1, 2, 3][-4]", NULL},
+		{`"monkey"[0]`, "m"},
+		{`"monkey"[-1]`, "y"},
+		{`"monkey"[6]`, NULL},
+		{`1[0]`, &object.Error{ErrorMessage: "index operator not supported: INTEGER[INTEGER]"}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	tests := []evalTestCase{
+		{`len("héllo")`, 5},
+		{`"héllo"[1]`, "é"},
+		{`"日本語"[-1]`, "語"},
+		{`"héllo"[1:3]`, "él"},
+		{`let f = fn() { let s = ""; for (c in "日本") { s = c + s; } s }; f()`, "本日"},
+		{`bytes("é")`, []int{195, 169}},
+		{`runes("é!")`, []int{233, 33}},
+		{`runes(1)`, &object.Error{ErrorMessage: "runes(): argument must be STRING, got INTEGER"}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []evalTestCase{
+		{`let a = 1; let b = 2; "total: ${a + b}"`, "total: 3"},
+		{`"${1.5} ${true} ${"x"}"`, "1.5 true x"},
+		{`"${"nested ${1 + 1}"}"`, "nested 2"},
+		{`"x${-true}y"`, &object.Error{ErrorMessage: "unsupported type for negation: BOOLEAN"}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestUserDefinedOperators(t *testing.T) {
+	tests := []evalTestCase{
+		{`infix 60 left <> = fn(a, b) { a + "-" + b }; "x" <> "y" <> "z"`, "x-y-z"},
+		{`infix 60 right <> = fn(a, b) { a - b }; 10 <> 5 <> 2`, 7},
+		{`infix 65 left |+| = fn(a, b) { push(a, b) }; [1] |+| 2 |+| 3`, []int{1, 2, 3}},
+		{`infix 60 left <> = fn(a, b) { a + b }; 1 <> true`, &object.Error{ErrorMessage: "unsupported operand types: INTEGER + BOOLEAN"}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestCapturedVariableAssignments(t *testing.T) {
+	tests := []evalTestCase{
+		{"let f = fn() { let i = 0; let g = fn() { i }; i = 5; g() }; f()", 5},
+		{"let f = fn() { let i = 0; let g = fn() { i }; i += 5; g() }; f()", 5},
+		{"let counter = fn() { let n = 0; fn() { n += 1; n } }; let c = counter(); c(); c(); c()", 3},
+		{"let counter = fn() { let n = 0; fn() { n += 1; n } }; let a = counter(); let b = counter(); a(); a(); b()", 1},
+		{"let mk = fn() { let n = 0; let inc = fn() { n += 1 }; let get = fn() { n }; [inc, get] }; let p = mk(); p[0](); p[0](); p[1]()", 2},
+		{"let f = fn(x) { let set = fn(v) { x = v }; set(7); x }; f(1)", 7},
+		{"let f = fn() { let n = 1; let g = fn() { fn() { n *= 10 } }; g()(); g()(); n }; f()", 100},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestIndexOutOfRangeErrors(t *testing.T) {
+	object.IndexOutOfRange = object.OutOfRangeError
+	defer func() { object.IndexOutOfRange = object.OutOfRangeNull }()
+
+	tests := []evalTestCase{
+		{"[1, 2, 3][3]", &object.Error{ErrorMessage: "index out of range: 3 (length 3)"}},
+		{"[1, 2, 3][-4]", &object.Error{ErrorMessage: "index out of range: -4 (length 3)"}},
+		{`"abc"[5]`, &object.Error{ErrorMessage: "index out of range: 5 (length 3)"}},
+		{"[1, 2, 3][-1]", 3},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []evalTestCase{
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][3:1]", []int{}},
+		{"[1, 2, 3, 4][-10:10]", []int{1, 2, 3, 4}},
+		{`"monkey"[1:3]`, "on"},
+		{`"monkey"[-3:]`, "key"},
+		{`"monkey"[true:]`, &object.Error{ErrorMessage: "slice bounds must be integers, got BOOLEAN"}},
+		{`1[1:]`, &object.Error{ErrorMessage: "slice operator not supported: INTEGER"}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []evalTestCase{
+		{"let x = 1; while (false) { x; }; x", 1},
+		{"let f = fn() { while (true) { return 5; } }; f()", 5},
+		{"let f = fn() { while (true) { break; } 7 }; f()", 7},
+		{"let f = fn(n) { while (n > 0) { if (n == 3) { break; } } n }; f(3)", 3},
+		{"if (true) { while (false) { } }", NULL},
+		{"break;", &object.Error{ErrorMessage: "break outside of a loop"}},
+		{"let f = fn() { continue; }; while (true) { f(); }", &object.Error{ErrorMessage: "continue outside of a loop"}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestForInLoops(t *testing.T) {
+	tests := []evalTestCase{
+		{"let f = fn(arr) { for (x in arr) { if (x > 2) { break; } } x }; f([1, 2, 3, 4])", 3},
+		{"let f = fn(arr) { for (x in arr) { if (x == 2) { continue; } x; } x }; f([1, 2, 3, 2])", 2},
+		{`let f = fn() { for (c in "abc"[1:]) { return c; } }; f()`, "b"},
+		{"let f = fn() { for (x in [[1, 2], [3, 4]]) { for (y in x) { if (y == 3) { return y; } } } }; f()", 3},
+		{"for (x in [1, 2]) { }; for (x in [3, 4, 5]) { }; x", 5},
+		{"let f = fn() { for (x in []) { return 1; } 0 }; f()", 0},
+		{"for (x in [1]) { let t = x; }; for (y in [2]) { let t = y; }; t", 2},
+		{"let f = fn() { let a = [0]; for (x in [1, 2, 3]) { a[0] += x; }; a[0] }; f()", 6},
+		{"for (x in 5) { }", &object.Error{ErrorMessage: "cannot iterate over INTEGER"}},
+		{`let f = fn() { for (x in {"a": 1}) { } }; f()`, &object.Error{ErrorMessage: "cannot iterate over HASH"}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []evalTestCase{
+		{"let a = 1; a = 2; a", 2},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		{"let a = 10; a += 5; a", 15},
+		{"let a = 10; a -= 5; a", 5},
+		{"let a = 10; a *= 5; a", 50},
+		{"let a = 10; a /= 5; a", 2},
+		{"let a = 1; let f = fn() { a = 5; }; f(); a", 5},
+		{"let i = 0; let sum = 0; while (i < 5) { i += 1; sum += i; }; sum", 15},
+		{"let n = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } n += x; }; n", 8},
+		{"let a = [1, 2, 3]; a[-1] = 5; a", []int{1, 2, 5}},
+		{"let a = [1, 2, 3]; a[1] += 10; a", []int{1, 12, 3}},
+		{"let a = [1, 2, 3]; let b = a; b[0] = 9; a", []int{9, 2, 3}},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] += 2; h["a"] + h["b"]`, 5},
+		{"b = 1", &object.Error{ErrorMessage: "undefined variable: b"}},
+		{"let a = [1]; a[1] = 2;", &object.Error{ErrorMessage: "index out of range: 1 (length 1)"}},
+		{`let s = "abc"; s[0] = "x";`, &object.Error{ErrorMessage: "index assignment not supported: STRING[INTEGER]"}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []evalTestCase{
+		{"true && false", false},
+		{"false || true", true},
+		{"1 && 2", true},
+		{"let x = 5; x > 0 && x < 10", true},
+		{"let x = 15; x < 0 || x > 10", true},
+		{"false && true || true", true},
+		{"true || false && false", true},
+		{"let calls = 0; let f = fn() { calls += 1; true }; false && f(); calls", 0},
+		{"let calls = 0; let f = fn() { calls += 1; true }; true || f(); calls", 0},
+		{"let calls = 0; let f = fn() { calls += 1; true }; true && f(); calls", 1},
+		{"false || undefined", &object.Error{ErrorMessage: "identifier 'undefined' not bind to any expression"}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestComparisonOperators(t *testing.T) {
+	tests := []evalTestCase{
+		{"7 % 3", 1},
+		{"2 + 7 % 3 * 2", 4},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"2 >= 3", false},
+		{`"a" + "b"`, "ab"},
+		{`"a" == "a"`, true},
+		{`"a" < "b"`, true},
+		{`"ab" < "abc"`, true},
+		{`"b" >= "abc"`, true},
+		{`1 + "a"`, &object.Error{ErrorMessage: "unsupported operand types: INTEGER + STRING"}},
+		{"true < false", &object.Error{ErrorMessage: "unsupported operand types: BOOLEAN < BOOLEAN"}},
+		{"1 == true", &object.Error{ErrorMessage: "unsupported operand types: INTEGER == BOOLEAN"}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []evalTestCase{
+		{"1.5 + 2.25", 3.75},
+		{"1 + 0.5", 1.5},
+		{"7 / 2.0", 3.5},
+		{"7 / 2", 3},
+		{"5.5 % 2", 1.5},
+		{"-2.5", -2.5},
+		{"1e3", 1000.0},
+		{"1 == 1.0", true},
+		{"2.5 >= 3", false},
+		{"int(-3.9)", -3},
+		{`int("42")`, 42},
+		{"float(2)", 2.0},
+		{`float("0.25")`, 0.25},
+		{"-true", &object.Error{ErrorMessage: "unsupported type for negation: BOOLEAN"}},
+		{"1.5 + true", &object.Error{ErrorMessage: "unsupported operand types: FLOAT + BOOLEAN"}},
+		{`int("x")`, &object.Error{ErrorMessage: `int(): can't parse "x" as INTEGER`}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestBigIntegers(t *testing.T) {
+	maxPlusOne, _ := new(big.Int).SetString("9223372036854775808", 10)
+	huge, _ := new(big.Int).SetString("100000000000000000000", 10)
+	tests := []evalTestCase{
+		{"9223372036854775807 + 1", maxPlusOne},
+		{"10000000000 * 10000000000", huge},
+		{"100000000000000000000", huge},
+		{"-((-9223372036854775807) - 1)", maxPlusOne},
+		{"(-9223372036854775807) - 1", math.MinInt64},
+		// prefix minus binds tighter than infix operators
+		{"-(-9223372036854775807 - 1)", maxPlusOne},
+		{"-9223372036854775807 - 1", math.MinInt64},
+		{"9223372036854775807 + 1 - 1", math.MaxInt64},
+		{"100000000000000000000 % 7", 2},
+		{"100000000000000000000 >= 10000000000 * 10000000000", true},
+		{"float(100000000000000000000)", 1e20},
+		{`100000000000000000000 + "a"`, &object.Error{ErrorMessage: "unsupported operand types: BIGINT + STRING"}},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestTopLevelReturns(t *testing.T) {
+	tests := []evalTestCase{
+		{"return 5; 10", 5},
+		{"if (true) { return 1; } 2", 1},
+		{"for (x in [1, 2]) { if (x == 2) { return x; } }", 2},
+		{"while (true) { if (true) { return 3; } }", 3},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestErrorPropagation(t *testing.T) {
+	tests := []evalTestCase{
+		{"1 / 0", &object.Error{ErrorMessage: "division by zero"}},
+		{"5 % 0", &object.Error{ErrorMessage: "modulo by zero"}},
+		{"1.0 / 0 > 1000", true},
+		{"1 + (2 / 0)", &object.Error{ErrorMessage: "division by zero"}},
+		{"-(1 / 0)", &object.Error{ErrorMessage: "division by zero"}},
+		{"[1, 2 / 0, 3]", &object.Error{ErrorMessage: "division by zero"}},
+		{"if (1 / 0) { 1 } else { 2 }", &object.Error{ErrorMessage: "division by zero"}},
+		{"let f = fn() { return 1 / 0; }; f(); 5", &object.Error{ErrorMessage: "division by zero"}},
+		{"let f = fn(x) { x }; f(1, 2)", &object.Error{ErrorMessage: "wrong number of arguments: want=1, got=2"}},
+		{"let f = fn(x, y) { x }; f(1)", &object.Error{ErrorMessage: "wrong number of arguments: want=2, got=1"}},
+		{"let calls = 0; let f = fn(x) { calls += 1; x }; len([f(1)]); calls", 1},
+		{"f(); let f = fn() { 1 };", &object.Error{ErrorMessage: "identifier 'f' not bind to any expression"}},
+		{"let f = fn(n) { f(n + 1) }; f(0)", &object.Error{ErrorMessage: "stack overflow"}},
+		{"let f = fn(n) { if (n == 0) { return 0; } 1 + f(n - 1) }; f(1000)", 1000},
+	}
+	runEvalTests(t, tests)
+}
+
+func TestComments(t *testing.T) {
+	tests := []evalTestCase{
+		{"# the answer\nlet a = 40; // almost\na + /* two */ 2", 42},
+		{"let a = 1; /* a = 2; /* nested */ a = 3; */ a", 1},
+	}
+	runEvalTests(t, tests)
+}
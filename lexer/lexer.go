@@ -1,23 +1,89 @@
 package lexer
 
-import "monkey/token"
+import (
+	"fmt"
+	"monkey/token"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 type Lexer struct {
+	// KeepComments makes NextToken return comments as COMMENT tokens instead of skipping them
+	KeepComments bool
+
+	filename     string
 	input        string
 	readPosition int
 	position     int  // current position, corresponds to current char
-	ch           byte // current char
+	ch           rune // current char, decoded from UTF-8
+	line         int  // line of the current char
+	column       int  // column of the current char, in runes
+	// interpolations holds, for each ${ of a string that isn't closed yet, the number of
+	// braces opened inside it, so that the '}' closing it resumes reading the string
+	interpolations []int
+	// operators are the symbols added with AddOperator, the longest first
+	operators []string
 }
 
-func New(input string) *Lexer {
-	l := &Lexer{input: input}
+// New returns a lexer for input, filename is only used in the positions of the tokens and may be empty.
+func New(filename string, input string) *Lexer {
+	l := &Lexer{filename: filename, input: input, line: 1}
 	l.readChar()
 	return l
 }
 
+// AddOperator makes the lexer read symbol, made of punctuation, as a single token of type
+// token.TokenType(symbol), e.g. "**" or "|>". Added operators are matched before the built-in tokens,
+// the longest first. An operator must be added before the lexer reads it, for a parser that's before
+// parser.ParseProgram, which reads the first tokens.
+func (l *Lexer) AddOperator(symbol string) {
+	if symbol == "" {
+		return
+	}
+	for _, op := range l.operators {
+		if op == symbol {
+			return
+		}
+	}
+	l.operators = append(l.operators, symbol)
+	sort.SliceStable(l.operators, func(i, j int) bool { return len(l.operators[i]) > len(l.operators[j]) })
+}
+
 func (l *Lexer) NextToken() token.Token {
+	for {
+		l.skipWhitespace()
+		pos := l.currentPosition()
+		tok := l.nextToken()
+		tok.Pos = pos
+		tok.End = l.currentPosition()
+		if tok.Type != token.COMMENT || l.KeepComments {
+			return tok
+		}
+	}
+}
+
+// currentPosition returns the position of the current char, past the end of input it's the end of input.
+func (l *Lexer) currentPosition() token.Position {
+	offset := l.position
+	if offset > len(l.input) {
+		offset = len(l.input)
+	}
+	return token.Position{
+		Filename: l.filename,
+		Offset:   offset,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
+func (l *Lexer) nextToken() token.Token {
+	if tok, ok := l.readOperator(); ok {
+		return tok
+	}
 	var tok token.Token
-	l.skipWhitespace()
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -29,9 +95,9 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.newAssignableToken(token.PLUS, token.PLUS_ASSIGN)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.newAssignableToken(token.MINUS, token.MINUS_ASSIGN)
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -42,13 +108,27 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		switch l.peekChar() {
+		case '/':
+			return l.readLineComment()
+		case '*':
+			return l.readBlockComment()
+		}
+		tok = l.newAssignableToken(token.SLASH, token.SLASH_ASSIGN)
+	case '#':
+		return l.readLineComment()
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		tok = l.newAssignableToken(token.ASTERISK, token.ASTERISK_ASSIGN)
+	case '&':
+		tok = l.newDoubleToken('&', token.AND)
+	case '|':
+		tok = l.newDoubleToken('|', token.OR)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		tok = l.newAssignableToken(token.LT, token.LT_EQ)
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		tok = l.newAssignableToken(token.GT, token.GT_EQ)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
@@ -56,8 +136,18 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		if n := len(l.interpolations); n > 0 {
+			if l.interpolations[n-1] == 0 {
+				l.interpolations = l.interpolations[:n-1]
+				return l.readString(token.STRING_MIDDLE, token.STRING_END)
+			}
+			l.interpolations[n-1]--
+		}
 		tok = newToken(token.RBRACE, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
@@ -68,8 +158,9 @@ func (l *Lexer) NextToken() token.Token {
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case '"':
-		str := l.readString()
-		tok = newStringToken(token.STRING, str)
+		return l.readString(token.STRING_START, token.STRING)
+	case '`':
+		tok = l.readRawString()
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -79,8 +170,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok = token.Token{Type: token.LookupIdent(ident), Literal: ident}
 			return tok
 		} else if isDigit(l.ch) {
-			tok = token.Token{Type: token.INT, Literal: l.readNumber()}
-			return tok
+			return l.readNumber()
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
@@ -89,6 +179,23 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
+// readOperator reads an operator added with AddOperator if one starts at the current char.
+func (l *Lexer) readOperator() (token.Token, bool) {
+	if l.position >= len(l.input) {
+		return token.Token{}, false
+	}
+	for _, op := range l.operators {
+		if strings.HasPrefix(l.input[l.position:], op) {
+			end := l.position + len(op)
+			for l.position < end {
+				l.readChar()
+			}
+			return token.Token{Type: token.TokenType(op), Literal: op}, true
+		}
+	}
+	return token.Token{}, false
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
@@ -96,20 +203,30 @@ func (l *Lexer) skipWhitespace() {
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	// the column stays at the end of input once it's reached
+	if l.readPosition <= len(l.input) {
+		l.column++
+	}
+	size := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, size = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += size
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
 
 func (l *Lexer) readIdentifier() string {
@@ -120,32 +237,202 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[startIndex:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer or a float. An integer may have a base prefix, 0x, 0o or 0b, a float
+// has a fraction part, e.g. 1.5, an exponent, e.g. 1e-3, or both. Digits may be separated by '_'.
+// The literal isn't validated here, the parser reports malformed literals.
+func (l *Lexer) readNumber() token.Token {
 	startIndex := l.position
-	for isDigit(l.ch) {
+	tokenType := token.TokenType(token.INT)
+	if l.ch == '0' && strings.ContainsRune("xXoObB", l.peekChar()) {
+		l.readChar()
+		l.readChar()
+	} else {
+		l.readDigits()
+		if l.ch == '.' && isDigit(l.peekChar()) {
+			tokenType = token.FLOAT
+			l.readChar()
+			l.readDigits()
+		}
+		if l.ch == 'e' || l.ch == 'E' {
+			next := l.readPosition
+			if next < len(l.input) && (l.input[next] == '+' || l.input[next] == '-') {
+				next++
+			}
+			if next < len(l.input) && isDigit(rune(l.input[next])) {
+				tokenType = token.FLOAT
+				for l.readPosition < next {
+					l.readChar()
+				}
+				l.readChar()
+				l.readDigits()
+			}
+		}
+	}
+	// letters and digits right after a number belong to it, so that e.g. 0b102 or 12ab is reported
+	// as a malformed literal instead of being split into a number and an identifier
+	for isLetter(l.ch) || isDigit(l.ch) {
+		l.readChar()
+	}
+	return token.Token{Type: tokenType, Literal: l.input[startIndex:l.position]}
+}
+
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
 		l.readChar()
 	}
-	return l.input[startIndex:l.position]
 }
 
-func (l *Lexer) readString() string {
+// readString reads a part of a string in double quotes, from the opening '"' or the '}' closing
+// an interpolation, and decodes its escape sequences. A part ending at "${" has the type interpolated,
+// one ending at the closing '"' the type closed. A malformed escape sequence doesn't stop the string,
+// the rest of the part is read so that lexing resumes after it.
+func (l *Lexer) readString(interpolated token.TokenType, closed token.TokenType) token.Token {
+	var out strings.Builder
+	var errMsg string
 	l.readChar()
-	startIndex := l.position
 	for l.ch != '"' {
+		switch {
+		case l.ch == 0:
+			return token.Token{Type: token.ERROR, Literal: "unterminated string"}
+		case l.ch == '$' && l.peekChar() == '{':
+			l.readChar()
+			l.readChar()
+			l.interpolations = append(l.interpolations, 0)
+			if errMsg != "" {
+				return token.Token{Type: token.ERROR, Literal: errMsg}
+			}
+			return newStringToken(interpolated, out.String())
+		case l.ch == '\\':
+			if msg := l.readEscape(&out); msg != "" && errMsg == "" {
+				errMsg = msg
+			}
+		default:
+			out.WriteRune(l.ch)
+		}
 		l.readChar()
 	}
-	return l.input[startIndex:l.position]
+	l.readChar()
+	if errMsg != "" {
+		return token.Token{Type: token.ERROR, Literal: errMsg}
+	}
+	return newStringToken(closed, out.String())
+}
+
+// readEscape decodes the escape sequence starting at the current '\\' into out, it leaves the lexer
+// on the last char of the sequence. It returns an error message if the sequence is malformed.
+func (l *Lexer) readEscape(out *strings.Builder) string {
+	l.readChar()
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '\\', '"', '$':
+		out.WriteRune(l.ch)
+	case 'u':
+		if l.peekChar() != '{' {
+			return "invalid unicode escape, expected \\u{...}"
+		}
+		l.readChar()
+		startIndex := l.readPosition
+		for l.peekChar() != '}' && l.peekChar() != '"' && l.peekChar() != 0 {
+			l.readChar()
+		}
+		digits := l.input[startIndex:l.readPosition]
+		if l.peekChar() != '}' {
+			return "invalid unicode escape, expected \\u{...}"
+		}
+		l.readChar()
+		code, err := strconv.ParseUint(digits, 16, 32)
+		if err != nil || len(digits) > 6 || !utf8.ValidRune(rune(code)) {
+			return fmt.Sprintf("invalid unicode escape \\u{%s}", digits)
+		}
+		out.WriteRune(rune(code))
+	case 0:
+		// the missing closing quote is reported by readString
+		return ""
+	default:
+		return fmt.Sprintf("unknown escape sequence \\%c", l.ch)
+	}
+	return ""
+}
+
+// readRawString reads a string in backquotes, it has no escape sequences and may span several lines.
+func (l *Lexer) readRawString() token.Token {
+	l.readChar()
+	startIndex := l.position
+	for l.ch != '`' {
+		if l.ch == 0 {
+			return token.Token{Type: token.ERROR, Literal: "unterminated raw string"}
+		}
+		l.readChar()
+	}
+	return newStringToken(token.STRING, l.input[startIndex:l.position])
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// readLineComment reads a comment starting with // or # up to the end of the line.
+func (l *Lexer) readLineComment() token.Token {
+	startIndex := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	return token.Token{Type: token.COMMENT, Literal: l.input[startIndex:l.position]}
+}
+
+// readBlockComment reads a /* */ comment, block comments nest so that code containing
+// comments can be commented out.
+func (l *Lexer) readBlockComment() token.Token {
+	startIndex := l.position
+	depth := 0
+	for {
+		switch {
+		case l.ch == 0:
+			return token.Token{Type: token.ERROR, Literal: "unterminated block comment"}
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+		}
+		l.readChar()
+		if depth == 0 {
+			return token.Token{Type: token.COMMENT, Literal: l.input[startIndex:l.position]}
+		}
+	}
+}
+
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+// newDoubleToken reads an operator made of the character ch repeated twice, e.g. "&&",
+// the single character is illegal.
+func (l *Lexer) newDoubleToken(ch rune, tokenType token.TokenType) token.Token {
+	if l.peekChar() == ch {
+		l.readChar()
+		return token.Token{Type: tokenType, Literal: string(ch) + string(ch)}
+	}
+	return newToken(token.ILLEGAL, l.ch)
+}
+
+// newAssignableToken reads an operator that may be followed by '=', e.g. '+' and '+=', or '<' and '<='.
+func (l *Lexer) newAssignableToken(op token.TokenType, assignOp token.TokenType) token.Token {
+	if l.peekChar() == '=' {
+		ch := l.ch
+		l.readChar()
+		return token.Token{Type: assignOp, Literal: string(ch) + string(l.ch)}
+	}
+	return newToken(op, l.ch)
+}
+
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
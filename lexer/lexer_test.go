@@ -0,0 +1,306 @@
+package lexer
+
+import (
+	"monkey/token"
+	"strings"
+	"testing"
+)
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n" +
+		"x >= 10\n" +
+		"  \"héllo\" + 1.5"
+	tests := []struct {
+		tokenType token.TokenType
+		literal   string
+		pos       string
+		end       string
+	}{
+		{token.LET, "let", "test.mk:1:1", "test.mk:1:4"},
+		{token.IDENT, "x", "test.mk:1:5", "test.mk:1:6"},
+		{token.ASSIGN, "=", "test.mk:1:7", "test.mk:1:8"},
+		{token.INT, "5", "test.mk:1:9", "test.mk:1:10"},
+		{token.SEMICOLON, ";", "test.mk:1:10", "test.mk:1:11"},
+		{token.IDENT, "x", "test.mk:2:1", "test.mk:2:2"},
+		{token.GT_EQ, ">=", "test.mk:2:3", "test.mk:2:5"},
+		{token.INT, "10", "test.mk:2:6", "test.mk:2:8"},
+		{token.STRING, "héllo", "test.mk:3:3", "test.mk:3:10"},
+		{token.PLUS, "+", "test.mk:3:11", "test.mk:3:12"},
+		{token.FLOAT, "1.5", "test.mk:3:13", "test.mk:3:16"},
+		{token.EOF, "", "test.mk:3:16", "test.mk:3:16"},
+	}
+	l := New("test.mk", input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.tokenType || tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - wrong token. want=%s %q, got=%s %q", i, tt.tokenType, tt.literal, tok.Type, tok.Literal)
+		}
+		if tok.Pos.String() != tt.pos {
+			t.Errorf("tests[%d] - wrong position of %q. want=%s, got=%s", i, tt.literal, tt.pos, tok.Pos)
+		}
+		if tok.End.String() != tt.end {
+			t.Errorf("tests[%d] - wrong end of %q. want=%s, got=%s", i, tt.literal, tt.end, tok.End)
+		}
+	}
+}
+
+func TestTokenOffsets(t *testing.T) {
+	input := "\"é\" x"
+	l := New("", input)
+	str := l.NextToken()
+	ident := l.NextToken()
+	// é is two bytes but one column
+	if str.End.Offset != 4 || str.End.Column != 4 {
+		t.Errorf("wrong end of string. want offset=4 column=4, got offset=%d column=%d", str.End.Offset, str.End.Column)
+	}
+	if ident.Pos.Offset != 5 || ident.Pos.String() != "1:5" {
+		t.Errorf("wrong position of identifier. want offset=5 1:5, got offset=%d %s", ident.Pos.Offset, ident.Pos)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `#!/usr/bin/env monkey
+let a = 10 / 2; // half
+/* a /* nested */ block
+   comment */ a /= 2 # done`
+	tests := []struct {
+		tokenType token.TokenType
+		literal   string
+	}{
+		{token.COMMENT, "#!/usr/bin/env monkey"},
+		{token.LET, "let"},
+		{token.IDENT, "a"},
+		{token.ASSIGN, "="},
+		{token.INT, "10"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// half"},
+		{token.COMMENT, "/* a /* nested */ block\n   comment */"},
+		{token.IDENT, "a"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "2"},
+		{token.COMMENT, "# done"},
+		{token.EOF, ""},
+	}
+
+	l := New("", input)
+	l.KeepComments = true
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.tokenType || tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - wrong token. want=%s %q, got=%s %q", i, tt.tokenType, tt.literal, tok.Type, tok.Literal)
+		}
+	}
+
+	// comments are skipped by default
+	l = New("", input)
+	for i, tt := range tests {
+		if tt.tokenType == token.COMMENT {
+			continue
+		}
+		tok := l.NextToken()
+		if tok.Type != tt.tokenType || tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - wrong token. want=%s %q, got=%s %q", i, tt.tokenType, tt.literal, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("", "1 /* a /* b */")
+	l.NextToken()
+	tok := l.NextToken()
+	if tok.Type != token.ERROR || tok.Literal != "unterminated block comment" {
+		t.Fatalf("wrong token. want=ERROR %q, got=%s %q", "unterminated block comment", tok.Type, tok.Literal)
+	}
+	if tok.Pos.Column != 3 || tok.End.Column != 15 {
+		t.Errorf("wrong span. want=1:3-1:15, got=%s-%s", tok.Pos, tok.End)
+	}
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Errorf("wrong token after the comment. want=EOF, got=%s", tok.Type)
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := "let größe = 日本 + _x;"
+	tests := []struct {
+		tokenType token.TokenType
+		literal   string
+		column    int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "größe", 5},
+		{token.ASSIGN, "=", 11},
+		{token.IDENT, "日本", 13},
+		{token.PLUS, "+", 16},
+		{token.IDENT, "_x", 18},
+		{token.SEMICOLON, ";", 20},
+		{token.EOF, "", 21},
+	}
+	l := New("", input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.tokenType || tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - wrong token. want=%s %q, got=%s %q", i, tt.tokenType, tt.literal, tok.Type, tok.Literal)
+		}
+		if tok.Pos.Column != tt.column {
+			t.Errorf("tests[%d] - wrong column. want=%d, got=%d", i, tt.column, tok.Pos.Column)
+		}
+	}
+}
+
+func TestColumnsOnLongLines(t *testing.T) {
+	input := "1\n" + strings.Repeat("é+", 50000) + "y"
+	l := New("", input)
+	var last token.Token
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		last = tok
+	}
+	if last.Literal != "y" || last.Pos.Line != 2 || last.Pos.Column != 100001 {
+		t.Fatalf("wrong last token. want y at 2:100001, got %q at %d:%d", last.Literal, last.Pos.Line, last.Pos.Column)
+	}
+	if eof := l.NextToken(); eof.Pos.Column != 100002 || eof.Pos.Offset != len(input) {
+		t.Errorf("wrong end of input. want column=100002 offset=%d, got column=%d offset=%d", len(input), eof.Pos.Column, eof.Pos.Offset)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input     string
+		tokenType token.TokenType
+		literal   string
+	}{
+		{`"plain"`, token.STRING, "plain"},
+		{`"a\nb\tc\r"`, token.STRING, "a\nb\tc\r"},
+		{`"say \"hi\" \\ bye"`, token.STRING, `say "hi" \ bye`},
+		{`"\u{48}\u{e9}\u{1F600}"`, token.STRING, "Hé😀"},
+		{"\"two\nlines\"", token.STRING, "two\nlines"},
+		{"`raw \\n \"q\"`", token.STRING, `raw \n "q"`},
+		{"`multi\nline`", token.STRING, "multi\nline"},
+		{`"\x"`, token.ERROR, `unknown escape sequence \x`},
+		{`"\u41"`, token.ERROR, `invalid unicode escape, expected \u{...}`},
+		{`"\u{41"`, token.ERROR, `invalid unicode escape, expected \u{...}`},
+		{`"\u{zz}"`, token.ERROR, `invalid unicode escape \u{zz}`},
+		{`"\u{D800}"`, token.ERROR, `invalid unicode escape \u{D800}`},
+		{`"never closed`, token.ERROR, "unterminated string"},
+		{`"ends in \`, token.ERROR, "unterminated string"},
+		{"`never closed", token.ERROR, "unterminated raw string"},
+	}
+	for _, tt := range tests {
+		tok := New("", tt.input).NextToken()
+		if tok.Type != tt.tokenType || tok.Literal != tt.literal {
+			t.Errorf("%s: wrong token. want=%s %q, got=%s %q", tt.input, tt.tokenType, tt.literal, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestTokensAfterStrings(t *testing.T) {
+	input := "\"a\\qb\" + `x\ny` + z"
+	expected := []struct {
+		tokenType token.TokenType
+		line      int
+		column    int
+	}{
+		{token.ERROR, 1, 1},
+		{token.PLUS, 1, 8},
+		{token.STRING, 1, 10},
+		{token.PLUS, 2, 4},
+		{token.IDENT, 2, 6},
+		{token.EOF, 2, 7},
+	}
+	l := New("", input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.tokenType || tok.Pos.Line != tt.line || tok.Pos.Column != tt.column {
+			t.Errorf("tests[%d] - wrong token. want=%s at %d:%d, got=%s at %s", i, tt.tokenType, tt.line, tt.column, tok.Type, tok.Pos)
+		}
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	input := `"a${x + {1: 2}[1]}b${"c${y}"}"`
+	expected := []struct {
+		tokenType token.TokenType
+		literal   string
+	}{
+		{token.STRING_START, "a"},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.LBRACE, "{"},
+		{token.INT, "1"},
+		{token.COLON, ":"},
+		{token.INT, "2"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.RBRACKET, "]"},
+		{token.STRING_MIDDLE, "b"},
+		{token.STRING_START, "c"},
+		{token.IDENT, "y"},
+		{token.STRING_END, ""},
+		{token.STRING_END, ""},
+		{token.EOF, ""},
+	}
+	l := New("", input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.tokenType || tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - wrong token. want=%s %q, got=%s %q", i, tt.tokenType, tt.literal, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := "0xFF+0o17 0b1_0 1_000.5e-3 12ab 1.5.x 3e x"
+	expected := []struct {
+		tokenType token.TokenType
+		literal   string
+	}{
+		{token.INT, "0xFF"},
+		{token.PLUS, "+"},
+		{token.INT, "0o17"},
+		{token.INT, "0b1_0"},
+		{token.FLOAT, "1_000.5e-3"},
+		{token.INT, "12ab"},
+		{token.FLOAT, "1.5"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.INT, "3e"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+	l := New("", input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.tokenType || tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - wrong token. want=%s %q, got=%s %q", i, tt.tokenType, tt.literal, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestAddOperator(t *testing.T) {
+	l := New("", "a ** b *= c |> d * e")
+	l.AddOperator("|>")
+	l.AddOperator("**")
+	expected := []struct {
+		tokenType token.TokenType
+		literal   string
+	}{
+		{token.IDENT, "a"},
+		{"**", "**"},
+		{token.IDENT, "b"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.IDENT, "c"},
+		{"|>", "|>"},
+		{token.IDENT, "d"},
+		{token.ASTERISK, "*"},
+		{token.IDENT, "e"},
+		{token.EOF, ""},
+	}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.tokenType || tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - wrong token. want=%s %q, got=%s %q", i, tt.tokenType, tt.literal, tok.Type, tok.Literal)
+		}
+	}
+}
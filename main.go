@@ -10,7 +10,7 @@ import (
 )
 
 func main() {
-	l := lexer.New("let a = 7;")
+	l := lexer.New("", "let a = 7;")
 	tok := l.NextToken()
 	for tok.Type != token.EOF {
 		fmt.Printf("%+v\n", tok)
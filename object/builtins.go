@@ -0,0 +1,207 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Builtins is shared by the evaluator and the compiler/vm, the compiler refers to a builtin
+// by its index in this slice, so new builtins should only be appended.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{"len", &Builtin{Fn: builtinLen}},
+	{"puts", &Builtin{Fn: builtinPuts}},
+	{"first", &Builtin{Fn: builtinFirst}},
+	{"last", &Builtin{Fn: builtinLast}},
+	{"rest", &Builtin{Fn: builtinRest}},
+	{"push", &Builtin{Fn: builtinPush}},
+	{"int", &Builtin{Fn: builtinInt}},
+	{"float", &Builtin{Fn: builtinFloat}},
+	{"bytes", &Builtin{Fn: builtinBytes}},
+	{"runes", &Builtin{Fn: builtinRunes}},
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, b := range Builtins {
+		if b.Name == name {
+			return b.Builtin
+		}
+	}
+	return nil
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{ErrorMessage: fmt.Sprintf(format, a...)}
+}
+
+// builtins return nil for null, each engine turns it into its own null object
+
+func builtinLen(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("len(): expect 1 arguments, but got %d", len(args))
+	}
+	switch obj := args[0].(type) {
+	case *Integer:
+		return &Integer{Value: 32}
+	case *String:
+		return &Integer{Value: int64(utf8.RuneCountInString(obj.Value))}
+	case *Array:
+		length := len(obj.Value)
+		return &Integer{Value: int64(length)}
+	default:
+		return newError("len (currently) doesn't support %s type", obj.Type())
+	}
+}
+
+func builtinPuts(args ...Object) Object {
+	for _, arg := range args {
+		fmt.Println(arg.Inspect())
+	}
+	return nil
+}
+
+func builtinFirst(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("first(): expect 1 arguments, but got %d", len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("first(): argument must be ARRAY, got %s", args[0].Type())
+	}
+	if len(arr.Value) == 0 {
+		return nil
+	}
+	return arr.Value[0]
+}
+
+func builtinLast(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("last(): expect 1 arguments, but got %d", len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("last(): argument must be ARRAY, got %s", args[0].Type())
+	}
+	if len(arr.Value) == 0 {
+		return nil
+	}
+	return arr.Value[len(arr.Value)-1]
+}
+
+func builtinRest(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("rest(): expect 1 arguments, but got %d", len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("rest(): argument must be ARRAY, got %s", args[0].Type())
+	}
+	if len(arr.Value) == 0 {
+		return nil
+	}
+	elements := make([]Object, len(arr.Value)-1)
+	copy(elements, arr.Value[1:])
+	return &Array{Value: elements}
+}
+
+func builtinPush(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("push(): expect 2 arguments, but got %d", len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("push(): first argument must be ARRAY, got %s", args[0].Type())
+	}
+	elements := make([]Object, len(arr.Value), len(arr.Value)+1)
+	copy(elements, arr.Value)
+	elements = append(elements, args[1])
+	return &Array{Value: elements}
+}
+
+// builtinInt converts a float, truncating it toward zero, or a string to an integer, which is
+// a BigInt if it doesn't fit in an int64.
+func builtinInt(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("int(): expect 1 arguments, but got %d", len(args))
+	}
+	switch arg := args[0].(type) {
+	case *Integer, *BigInt:
+		return arg
+	case *Float:
+		if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+			return newError("int(): %s can't be converted to INTEGER", arg.Inspect())
+		}
+		value, _ := big.NewFloat(arg.Value).Int(nil)
+		return IntegerFromBig(value)
+	case *String:
+		value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+		if !ok {
+			return newError("int(): can't parse %q as INTEGER", arg.Value)
+		}
+		return IntegerFromBig(value)
+	default:
+		return newError("int(): argument must be INTEGER, FLOAT or STRING, got %s", arg.Type())
+	}
+}
+
+// builtinFloat converts an integer or a string to a float.
+func builtinFloat(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("float(): expect 1 arguments, but got %d", len(args))
+	}
+	switch arg := args[0].(type) {
+	case *Integer:
+		return &Float{Value: float64(arg.Value)}
+	case *BigInt:
+		value, _ := new(big.Float).SetInt(arg.Value).Float64()
+		return &Float{Value: value}
+	case *Float:
+		return arg
+	case *String:
+		value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+		if err != nil {
+			return newError("float(): can't parse %q as FLOAT", arg.Value)
+		}
+		return &Float{Value: value}
+	default:
+		return newError("float(): argument must be INTEGER, FLOAT or STRING, got %s", arg.Type())
+	}
+}
+
+// builtinBytes returns the UTF-8 encoding of a string as an array of integers.
+func builtinBytes(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("bytes(): expect 1 arguments, but got %d", len(args))
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("bytes(): argument must be STRING, got %s", args[0].Type())
+	}
+	elements := make([]Object, len(str.Value))
+	for i := 0; i < len(str.Value); i++ {
+		elements[i] = &Integer{Value: int64(str.Value[i])}
+	}
+	return &Array{Value: elements}
+}
+
+// builtinRunes returns the code points of a string as an array of integers.
+func builtinRunes(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("runes(): expect 1 arguments, but got %d", len(args))
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("runes(): argument must be STRING, got %s", args[0].Type())
+	}
+	elements := make([]Object, 0, utf8.RuneCountInString(str.Value))
+	for _, r := range str.Value {
+		elements = append(elements, &Integer{Value: int64(r)})
+	}
+	return &Array{Value: elements}
+}
@@ -0,0 +1,94 @@
+package object
+
+import "fmt"
+
+// OutOfRangePolicy decides what indexing an array or a string outside of its bounds results in.
+type OutOfRangePolicy int
+
+const (
+	// OutOfRangeNull makes an out of range index evaluate to null
+	OutOfRangeNull OutOfRangePolicy = iota
+	// OutOfRangeError makes an out of range index a runtime error
+	OutOfRangeError
+)
+
+// IndexOutOfRange is the policy followed by both the evaluator and the vm.
+var IndexOutOfRange = OutOfRangeNull
+
+// NormalizeIndex turns a possibly negative index (counting from the end, as in Python)
+// into a position in a sequence of the given length. ok is false if the index is out of range.
+func NormalizeIndex(index int64, length int) (int, bool) {
+	if index < 0 {
+		index += int64(length)
+	}
+	if index < 0 || index >= int64(length) {
+		return 0, false
+	}
+	return int(index), true
+}
+
+// SliceBounds resolves the bounds of a slice of a sequence of the given length, the bounds are
+// either integers or null for an omitted bound. As in Python, negative bounds count from the end
+// and bounds out of range are clamped, so slicing never fails because of the length.
+func SliceBounds(start Object, end Object, length int) (int, int, error) {
+	lo, err := sliceBound(start, 0, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	hi, err := sliceBound(end, length, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	if hi < lo {
+		hi = lo
+	}
+	return lo, hi, nil
+}
+
+func sliceBound(bound Object, omitted int, length int) (int, error) {
+	switch bound := bound.(type) {
+	case *Null:
+		return omitted, nil
+	case *Integer:
+		i := bound.Value
+		if i < 0 {
+			i += int64(length)
+		}
+		if i < 0 {
+			i = 0
+		}
+		if i > int64(length) {
+			i = int64(length)
+		}
+		return int(i), nil
+	default:
+		return 0, fmt.Errorf("slice bounds must be integers, got %s", bound.Type())
+	}
+}
+
+// SetIndex implements left[index] = value, arrays and hashes are mutated in place so the change
+// is visible through every reference to them. Unlike reading, writing out of range always fails.
+func SetIndex(left Object, index Object, value Object) error {
+	switch left := left.(type) {
+	case *Array:
+		integer, ok := index.(*Integer)
+		if !ok {
+			return fmt.Errorf("index assignment not supported: %s[%s]", left.Type(), index.Type())
+		}
+		i, ok := NormalizeIndex(integer.Value, len(left.Value))
+		if !ok {
+			return fmt.Errorf("index out of range: %d (length %d)", integer.Value, len(left.Value))
+		}
+		left.Value[i] = value
+		return nil
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = HashPair{Key: index, Value: value}
+		return nil
+	default:
+		return fmt.Errorf("index assignment not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
@@ -3,8 +3,12 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"hash/fnv"
+	"math/big"
 	"monkey/ast"
 	"monkey/code"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -13,6 +17,8 @@ type BuiltinFunction func(args ...Object) Object
 
 const (
 	INTEGER_OBJ           = "INTEGER"
+	BIGINT_OBJ            = "BIGINT"
+	FLOAT_OBJ             = "FLOAT"
 	BOOLEAN_OBJ           = "BOOLEAN"
 	NULL_OBJ              = "NULL"
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
@@ -22,11 +28,18 @@ const (
 	BUILTIN_OBJ           = "BUILTIN"
 	ARRAY_OBJ             = "ARRAY"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
+	CLOSURE_OBJ           = "CLOSURE"
+	CELL_OBJ              = "CELL"
+	HASH_OBJ              = "HASH"
+	BREAK_OBJ             = "BREAK"
+	CONTINUE_OBJ          = "CONTINUE"
 )
 
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	// CallDepth is the number of function calls that are running when the environment is used
+	CallDepth int
 }
 
 func NewEnvironment() *Environment {
@@ -36,7 +49,7 @@ func NewEnvironment() *Environment {
 
 func NewCloseEnvironment(outer *Environment) *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: outer}
+	return &Environment{store: s, outer: outer, CallDepth: outer.CallDepth}
 }
 
 func (e *Environment) Get(key string) (Object, bool) {
@@ -54,11 +67,35 @@ func (e *Environment) Set(key string, val Object) {
 	e.store[key] = val
 }
 
+// Assign sets the variable in the environment that defines it, ok is false if no environment does.
+func (e *Environment) Assign(key string, val Object) bool {
+	if _, ok := e.store[key]; ok {
+		e.store[key] = val
+		return true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(key, val)
+	}
+	return false
+}
+
 type Object interface {
 	Type() ObjectType
 	Inspect() string
 }
 
+// HashKey identifies the key of a hash pair, two objects of the same type and value
+// have the same HashKey.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by the objects that can be used as hash keys.
+type Hashable interface {
+	HashKey() HashKey
+}
+
 type Integer struct {
 	Value int64
 }
@@ -69,6 +106,55 @@ func (i *Integer) Type() ObjectType {
 func (i *Integer) Inspect() string {
 	return fmt.Sprintf("%d", i.Value)
 }
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+// BigInt is an integer that doesn't fit in an int64, integer arithmetic promotes its result
+// to a BigInt on overflow and demotes it back to an Integer once it fits again, see IntegerFromBig.
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType {
+	return BIGINT_OBJ
+}
+func (b *BigInt) Inspect() string {
+	return b.Value.String()
+}
+func (b *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write(b.Value.Bytes())
+	if b.Value.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+
+// IntegerFromBig returns an Integer if the value fits in an int64, a BigInt otherwise.
+func IntegerFromBig(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInt{Value: value}
+}
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
+// Inspect always shows a float with a fraction part or an exponent, so 1.0 isn't mistaken for 1.
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
 
 type Boolean struct {
 	Value bool
@@ -80,6 +166,13 @@ func (i *Boolean) Type() ObjectType {
 func (i *Boolean) Inspect() string {
 	return fmt.Sprintf("%t", i.Value)
 }
+func (i *Boolean) HashKey() HashKey {
+	var value uint64
+	if i.Value {
+		value = 1
+	}
+	return HashKey{Type: i.Type(), Value: value}
+}
 
 type Null struct{}
 
@@ -101,6 +194,18 @@ func (i *ReturnValue) Inspect() string {
 	return fmt.Sprintf("return val: " + i.Value.Inspect())
 }
 
+// Break and Continue are the values of break and continue statements in the evaluator,
+// they are passed up to the enclosing loop like return values to the enclosing function.
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
 type Error struct {
 	ErrorMessage string
 }
@@ -139,7 +244,14 @@ func (f *Function) Inspect() string {
 }
 
 type CompiledFunction struct {
-	Instructions code.Instructions
+	Instructions  code.Instructions
+	NumParameters int
+	// NumLocals includes the parameters
+	NumLocals int
+	// Name is the name the function is bound to, empty for anonymous functions
+	Name string
+	// Lines maps the instructions to the source lines they are compiled from
+	Lines code.LineTable
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -147,6 +259,50 @@ func (cf *CompiledFunction) Inspect() string {
 	return fmt.Sprintf("CompiledFunction[%p]", cf)
 }
 
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Cell
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// Cell holds a variable captured by a closure, so that the closure and the function defining the
+// variable share it. While that function runs, the cell refers to the stack slot of the variable,
+// when it returns the value is moved into the cell, see Close.
+type Cell struct {
+	ref   *Object
+	value Object
+}
+
+// NewCell returns an open cell referring to the variable at ref.
+func NewCell(ref *Object) *Cell {
+	return &Cell{ref: ref}
+}
+
+// NewClosedCell returns a cell holding value, for a captured value that can't be assigned.
+func NewClosedCell(value Object) *Cell {
+	c := &Cell{value: value}
+	c.ref = &c.value
+	return c
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string {
+	return fmt.Sprintf("Cell[%p]", c)
+}
+
+func (c *Cell) Get() Object      { return *c.ref }
+func (c *Cell) Set(value Object) { *c.ref = value }
+
+// Close moves the value of the variable into the cell, once the stack slot it refers to is released.
+func (c *Cell) Close() {
+	c.value = *c.ref
+	c.ref = &c.value
+}
+
 type String struct {
 	Value string
 }
@@ -157,13 +313,42 @@ func (s *String) Type() ObjectType {
 func (s *String) Inspect() string {
 	return s.Value
 }
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
 
 type Array struct {
 	Value []Object
 }
 
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
 type Hash struct {
-	Pairs map[Object]Object
+	Pairs map[HashKey]HashPair
+}
+
+func (h *Hash) Type() ObjectType {
+	return HASH_OBJ
+}
+
+// Inspect prints the pairs ordered by their keys, so the output is stable.
+func (h *Hash) Inspect() string {
+	pairs := []string{}
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	sort.Strings(pairs)
+
+	var out bytes.Buffer
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
 }
 
 func (a *Array) Type() ObjectType {
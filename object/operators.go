@@ -0,0 +1,247 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// The operators are shared by the evaluator and the vm, so both report the same results and errors.
+
+// Integer division by zero is an error, float division follows IEEE 754 and gives an infinity or NaN.
+var (
+	errDivisionByZero = errors.New("division by zero")
+	errModuloByZero   = errors.New("modulo by zero")
+)
+
+func unsupportedOperands(op string, left Object, right Object) error {
+	return fmt.Errorf("unsupported operand types: %s %s %s", left.Type(), op, right.Type())
+}
+
+// BuildString concatenates the parts of an interpolated string, each part is shown by its Inspect.
+func BuildString(parts []Object) *String {
+	var out strings.Builder
+	for _, part := range parts {
+		out.WriteString(part.Inspect())
+	}
+	return &String{Value: out.String()}
+}
+
+// toFloat returns the value of a number as a float, it's how an integer operand is promoted
+// when the other operand is a float.
+func toFloat(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f, true
+	case *Float:
+		return obj.Value, true
+	default:
+		return 0, false
+	}
+}
+
+// toBig returns the value of an integer or a big integer as a big.Int.
+func toBig(obj Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value), true
+	case *BigInt:
+		return obj.Value, true
+	default:
+		return nil, false
+	}
+}
+
+// isFloatPair reports whether the operands are both numbers and at least one of them is a float.
+func isFloatPair(left Object, right Object) bool {
+	_, leftIsNumber := toFloat(left)
+	_, rightIsNumber := toFloat(right)
+	return leftIsNumber && rightIsNumber &&
+		(left.Type() == FLOAT_OBJ || right.Type() == FLOAT_OBJ)
+}
+
+// BinaryOp applies one of the arithmetic operators + - * / %. Integer operands give an integer,
+// which is promoted to a BigInt if it overflows an int64. If either operand is a float the other
+// one is promoted and the result is a float.
+func BinaryOp(op string, left Object, right Object) (Object, error) {
+	if isFloatPair(left, right) {
+		l, _ := toFloat(left)
+		r, _ := toFloat(right)
+		return floatBinaryOp(op, l, r)
+	}
+	switch left := left.(type) {
+	case *Integer:
+		if right, ok := right.(*Integer); ok {
+			return integerBinaryOp(op, left.Value, right.Value)
+		}
+		if right, ok := right.(*BigInt); ok {
+			return bigBinaryOp(op, big.NewInt(left.Value), right.Value)
+		}
+	case *BigInt:
+		if right, ok := toBig(right); ok {
+			return bigBinaryOp(op, left.Value, right)
+		}
+	case *String:
+		if right, ok := right.(*String); ok && op == "+" {
+			return &String{Value: left.Value + right.Value}, nil
+		}
+	}
+	return nil, unsupportedOperands(op, left, right)
+}
+
+func integerBinaryOp(op string, left int64, right int64) (Object, error) {
+	var res int64
+	var overflow bool
+	switch op {
+	case "+":
+		res = left + right
+		overflow = (left > 0 && right > 0 && res < 0) || (left < 0 && right < 0 && res >= 0)
+	case "-":
+		res = left - right
+		overflow = (left >= 0 && right < 0 && res < 0) || (left < 0 && right > 0 && res >= 0)
+	case "*":
+		res = left * right
+		overflow = left != 0 && (res/left != right || (left == -1 && right == math.MinInt64))
+	case "/":
+		if right == 0 {
+			return nil, errDivisionByZero
+		}
+		overflow = left == math.MinInt64 && right == -1
+		if !overflow {
+			res = left / right
+		}
+	case "%":
+		if right == 0 {
+			return nil, errModuloByZero
+		}
+		res = left % right
+	default:
+		return nil, fmt.Errorf("unknown operator: INTEGER %s INTEGER", op)
+	}
+	if overflow {
+		return bigBinaryOp(op, big.NewInt(left), big.NewInt(right))
+	}
+	return &Integer{Value: res}, nil
+}
+
+func bigBinaryOp(op string, left *big.Int, right *big.Int) (Object, error) {
+	res := new(big.Int)
+	if right.Sign() == 0 && (op == "/" || op == "%") {
+		if op == "/" {
+			return nil, errDivisionByZero
+		}
+		return nil, errModuloByZero
+	}
+	switch op {
+	case "+":
+		res.Add(left, right)
+	case "-":
+		res.Sub(left, right)
+	case "*":
+		res.Mul(left, right)
+	case "/":
+		res.Quo(left, right)
+	case "%":
+		res.Rem(left, right)
+	default:
+		return nil, fmt.Errorf("unknown operator: BIGINT %s BIGINT", op)
+	}
+	return IntegerFromBig(res), nil
+}
+
+func floatBinaryOp(op string, left float64, right float64) (Object, error) {
+	var res float64
+	switch op {
+	case "+":
+		res = left + right
+	case "-":
+		res = left - right
+	case "*":
+		res = left * right
+	case "/":
+		res = left / right
+	case "%":
+		res = math.Mod(left, right)
+	default:
+		return nil, fmt.Errorf("unknown operator: FLOAT %s FLOAT", op)
+	}
+	return &Float{Value: res}, nil
+}
+
+// Negate applies the prefix operator -.
+func Negate(operand Object) (Object, error) {
+	switch operand := operand.(type) {
+	case *Integer:
+		if operand.Value == math.MinInt64 {
+			return IntegerFromBig(new(big.Int).Neg(big.NewInt(operand.Value))), nil
+		}
+		return &Integer{Value: -operand.Value}, nil
+	case *BigInt:
+		return IntegerFromBig(new(big.Int).Neg(operand.Value)), nil
+	case *Float:
+		return &Float{Value: -operand.Value}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type for negation: %s", operand.Type())
+	}
+}
+
+// Compare applies one of the comparison operators == != < > <= >=. Numbers and strings
+// support all of them, booleans only equality. An integer compared with a float is promoted.
+func Compare(op string, left Object, right Object) (bool, error) {
+	if isFloatPair(left, right) {
+		l, _ := toFloat(left)
+		r, _ := toFloat(right)
+		return compareOrdered(op, l, r), nil
+	}
+	if left.Type() == BIGINT_OBJ || right.Type() == BIGINT_OBJ {
+		l, leftIsInteger := toBig(left)
+		r, rightIsInteger := toBig(right)
+		if leftIsInteger && rightIsInteger {
+			return compareOrdered(op, int64(l.Cmp(r)), 0), nil
+		}
+	}
+	switch left := left.(type) {
+	case *Integer:
+		if right, ok := right.(*Integer); ok {
+			return compareOrdered(op, left.Value, right.Value), nil
+		}
+	case *String:
+		if right, ok := right.(*String); ok {
+			return compareOrdered(op, left.Value, right.Value), nil
+		}
+	case *Boolean:
+		if right, ok := right.(*Boolean); ok {
+			switch op {
+			case "==":
+				return left.Value == right.Value, nil
+			case "!=":
+				return left.Value != right.Value, nil
+			}
+		}
+	}
+	return false, unsupportedOperands(op, left, right)
+}
+
+func compareOrdered[T int64 | float64 | string](op string, left T, right T) bool {
+	switch op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	case "<":
+		return left < right
+	case ">":
+		return left > right
+	case "<=":
+		return left <= right
+	case ">=":
+		return left >= right
+	default:
+		return false
+	}
+}
@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"fmt"
+	"monkey/token"
+	"strings"
+	"unicode/utf8"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Diagnostic is a problem found in the source, Pos and End span the offending code.
+type Diagnostic struct {
+	Severity Severity
+	Pos      token.Position
+	End      token.Position
+	Message  string
+}
+
+// String returns the diagnostic in the file:line:column: severity: message form.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Message)
+}
+
+// Render returns the diagnostic followed by the source line it points to, with the span
+// underlined by carets, e.g.
+//
+//	2:9: error: expected an expression, got ';'
+//	let x = ;
+//	        ^
+//
+// source is the whole input the positions refer to. A span over several lines is underlined
+// up to the end of its first line.
+func Render(d Diagnostic, source string) string {
+	var out strings.Builder
+	out.WriteString(d.String())
+	out.WriteString("\n")
+	if !d.Pos.IsValid() || d.Pos.Offset > len(source) {
+		return out.String()
+	}
+
+	lineStart := strings.LastIndexByte(source[:d.Pos.Offset], '\n') + 1
+	lineEnd := len(source)
+	if i := strings.IndexByte(source[d.Pos.Offset:], '\n'); i >= 0 {
+		lineEnd = d.Pos.Offset + i
+	}
+	line := strings.TrimSuffix(source[lineStart:lineEnd], "\r")
+	out.WriteString(line)
+	out.WriteString("\n")
+
+	// keep the tabs of the line so the carets line up with it
+	for _, r := range source[lineStart:d.Pos.Offset] {
+		if r == '\t' {
+			out.WriteRune('\t')
+		} else {
+			out.WriteRune(' ')
+		}
+	}
+	width := 1
+	if d.End.Line == d.Pos.Line && d.End.Offset > d.Pos.Offset {
+		width = d.End.Column - d.Pos.Column
+	} else if d.End.Line > d.Pos.Line {
+		width = utf8.RuneCountInString(line[d.Pos.Offset-lineStart:])
+	}
+	if width < 1 {
+		width = 1
+	}
+	out.WriteString(strings.Repeat("^", width))
+	out.WriteString("\n")
+	return out.String()
+}
+
+// describeToken describes a token for a diagnostic message.
+func describeToken(tok token.Token) string {
+	switch tok.Type {
+	case token.EOF:
+		return "end of input"
+	case token.STRING:
+		return fmt.Sprintf("string %q", tok.Literal)
+	case token.STRING_MIDDLE, token.STRING_END:
+		return "'}'"
+	case token.ILLEGAL:
+		return fmt.Sprintf("illegal character '%s'", tok.Literal)
+	default:
+		return fmt.Sprintf("'%s'", tok.Literal)
+	}
+}
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// integerBase returns the base of an integer literal, the name of the base for error messages, and
+// the digits of the literal after its base prefix.
+func integerBase(lit string) (int, string, string) {
+	if len(lit) >= 2 && lit[0] == '0' {
+		switch lit[1] {
+		case 'x', 'X':
+			return 16, "hexadecimal", lit[2:]
+		case 'o', 'O':
+			return 8, "octal", lit[2:]
+		case 'b', 'B':
+			return 2, "binary", lit[2:]
+		}
+	}
+	return 10, "decimal", lit
+}
+
+// digitValue returns the value of a digit in bases up to 36, it's 36 for a character that isn't a digit.
+func digitValue(ch rune) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'z':
+		return int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'Z':
+		return int(ch-'A') + 10
+	}
+	return 36
+}
+
+func isDecimalDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+// checkSeparators checks that each '_' in digits is between two digits, like in Go a '_' may also
+// follow a base prefix.
+func checkSeparators(lit string, digits string, isDigit func(byte) bool, prefixed bool) error {
+	for i := 0; i < len(digits); i++ {
+		if digits[i] != '_' {
+			continue
+		}
+		afterDigit := i > 0 && isDigit(digits[i-1]) || i == 0 && prefixed
+		beforeDigit := i+1 < len(digits) && isDigit(digits[i+1])
+		if !afterDigit || !beforeDigit {
+			return fmt.Errorf("'_' must separate successive digits in %s", lit)
+		}
+	}
+	return nil
+}
+
+// parseInteger parses an integer literal, e.g. 42, 1_000, 0xFF, 0o17 or 0b1010, of any size.
+func parseInteger(lit string) (*big.Int, error) {
+	base, name, digits := integerBase(lit)
+	if digits == "" {
+		return nil, fmt.Errorf("%s literal %s has no digits", name, lit)
+	}
+	for _, ch := range digits {
+		if ch != '_' && digitValue(ch) >= base {
+			return nil, fmt.Errorf("invalid digit %q in %s literal %s", ch, name, lit)
+		}
+	}
+	isDigit := func(ch byte) bool { return digitValue(rune(ch)) < base }
+	if err := checkSeparators(lit, digits, isDigit, len(digits) < len(lit)); err != nil {
+		return nil, err
+	}
+	if base == 10 && len(digits) > 1 && digits[0] == '0' {
+		return nil, fmt.Errorf("invalid decimal literal %s, leading zeros aren't allowed, octal literals start with 0o", lit)
+	}
+	value, _ := new(big.Int).SetString(strings.ReplaceAll(digits, "_", ""), base)
+	return value, nil
+}
+
+// parseFloat parses a float literal, e.g. 1.5, 1e-3 or 1_000.5.
+func parseFloat(lit string) (float64, error) {
+	for _, ch := range lit {
+		if !strings.ContainsRune("0123456789._eE+-", ch) {
+			return 0, fmt.Errorf("invalid character %q in float literal %s", ch, lit)
+		}
+	}
+	if err := checkSeparators(lit, lit, isDecimalDigit, false); err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(lit, "_", ""), 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("float literal %s overflows FLOAT", lit)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("malformed float literal %s", lit)
+	}
+	return value, nil
+}
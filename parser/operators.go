@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/token"
+	"strconv"
+	"strings"
+)
+
+// InfixOperator is a user-defined infix operator, declared in the source with
+//
+//	infix 60 left <> = fn(a, b) { ... }
+//
+// a <> b is parsed as a call of the function bound to the name (<>), so it needs no support from the
+// evaluator or the compiler.
+type InfixOperator struct {
+	Symbol        string
+	Precedence    int
+	Associativity Associativity
+}
+
+// FunctionName is the name the function of the operator is bound to, e.g. (<>).
+func (op InfixOperator) FunctionName() string {
+	return "(" + op.Symbol + ")"
+}
+
+// operatorChars are the characters a user-defined operator is made of.
+const operatorChars = "!$%&*+-./<=>?@^|~"
+
+// DeclareInfixOperator declares a user-defined infix operator as if by an infix statement, e.g. for
+// a REPL to keep the operators declared by the previous inputs. Only the operator is declared, the
+// function bound to its name must already be defined.
+func (p *Parser) DeclareInfixOperator(op InfixOperator) {
+	tokenType := token.TokenType(op.Symbol)
+	p.l.AddOperator(op.Symbol)
+	p.precedences[tokenType] = op.Precedence
+	p.rightAssociative[tokenType] = op.Associativity == RightAssociative
+	p.registerInfix(tokenType, p.parseOperatorCall)
+	for i := range p.operators {
+		if p.operators[i].Symbol == op.Symbol {
+			p.operators[i] = op
+			return
+		}
+	}
+	p.operators = append(p.operators, op)
+}
+
+// InfixOperators returns the user-defined infix operators declared so far.
+func (p *Parser) InfixOperators() []InfixOperator {
+	return p.operators
+}
+
+// isOperatorToken reports whether tok can be a part of the symbol of a user-defined operator.
+func isOperatorToken(tok token.Token) bool {
+	if tok.Literal == "" || tok.Type == token.STRING || tok.Type == token.ERROR {
+		return false
+	}
+	for _, ch := range tok.Literal {
+		if !strings.ContainsRune(operatorChars, ch) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseInfixDeclaration parses an infix statement, infix <precedence> left|right <symbol> = <function>,
+// into a let statement binding the function to the name of the operator. The operator can be used
+// from the end of the statement on.
+func (p *Parser) parseInfixDeclaration() ast.Statement {
+	stmt := &ast.LetStatement{Token: p.curToken}
+	if p.blockDepth > 0 {
+		p.addError(p.curToken, "infix operators can only be declared at the top level")
+		return nil
+	}
+	p.nextToken()
+	precedence, err := strconv.Atoi(p.curToken.Literal)
+	if err != nil || precedence <= LOWEST || precedence >= PREFIX {
+		p.addError(p.curToken, "the precedence of an infix operator must be between %d and %d, got %s",
+			LOWEST+1, PREFIX-1, p.curToken.Literal)
+		return nil
+	}
+	op := InfixOperator{Precedence: precedence}
+	switch {
+	case p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "left":
+		op.Associativity = LeftAssociative
+	case p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "right":
+		op.Associativity = RightAssociative
+	default:
+		p.peekError("'left' or 'right'", "after the precedence of the operator")
+		return nil
+	}
+	p.nextToken()
+
+	// the symbol isn't known to the lexer yet, so it's read as several tokens, e.g. <> as < and >,
+	// the symbol is made of the tokens that follow each other without any space
+	if !isOperatorToken(p.peekToken) {
+		p.peekError("an operator symbol", "after the associativity of the operator")
+		return nil
+	}
+	p.nextToken()
+	symbol := p.curToken
+	tokens := 1
+	for isOperatorToken(p.peekToken) && p.peekToken.Pos.Offset == p.curToken.End.Offset {
+		p.nextToken()
+		symbol.Literal += p.curToken.Literal
+		symbol.End = p.curToken.End
+		tokens++
+	}
+	if tokens == 1 && symbol.Type != token.ILLEGAL && !p.isDeclaredOperator(symbol.Type) {
+		p.addError(symbol, "can't declare the built-in operator %s", symbol.Literal)
+		return nil
+	}
+	op.Symbol = symbol.Literal
+	symbol.Type = token.TokenType(op.Symbol)
+	if !p.expectPeek(token.ASSIGN) {
+		p.peekError("'='", "after the operator symbol")
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Name = &ast.Identifier{Token: symbol, Value: op.FunctionName()}
+	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		if len(fl.Parameters) != 2 {
+			p.errorAt(fl.Pos(), fl.End(), "the function of an infix operator takes 2 parameters, got %d", len(fl.Parameters))
+			return nil
+		}
+		fl.Name = stmt.Name.Value
+	}
+	p.DeclareInfixOperator(op)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) isDeclaredOperator(tokenType token.TokenType) bool {
+	for _, op := range p.operators {
+		if token.TokenType(op.Symbol) == tokenType {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOperatorCall parses a use of a user-defined operator, a <> b, into the call (<>)(a, b).
+func (p *Parser) parseOperatorCall(left ast.Expression) ast.Expression {
+	call := &ast.CallExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Function: &ast.Identifier{Token: p.curToken, Value: InfixOperator{Symbol: p.curToken.Literal}.FunctionName()},
+	}
+	precedence := p.rightOperandPrecedence()
+	p.nextToken()
+	right := p.parseExpression(precedence)
+	if right == nil {
+		return nil
+	}
+	call.Arguments = []ast.Expression{left, right}
+	return call
+}
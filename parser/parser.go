@@ -5,32 +5,55 @@ import (
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
-	"strconv"
 )
 
+// The precedence levels, from the loosest to the tightest binding. They are spaced so that operators
+// registered with RegisterInfixOperator can get a level between two of them, e.g. SUM + 5.
 const (
-	_ int = iota
+	_ int = iota * 10
 	LOWEST
+	ASSIGN
+	LOGICAL_OR
+	LOGICAL_AND
 	EQUALS
 	LESSGREATER
 	SUM
 	PRODUCT
-	PREFIX
-	CALL
-	ARRAYACCESS
+	PREFIX // -x, !x
+	CALL   // f(x)
+	INDEX  // a[i], a[i:j]
 )
 
-var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: ARRAYACCESS,
+// Associativity tells how a chain of infix operators of the same precedence is grouped.
+type Associativity int
+
+const (
+	LeftAssociative  Associativity = iota // a - b - c is (a - b) - c
+	RightAssociative                      // a ** b ** c is a ** (b ** c)
+)
+
+// defaultPrecedences is the precedence of the built-in infix operators, each parser starts with a copy.
+var defaultPrecedences = map[token.TokenType]int{
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.OR:              LOGICAL_OR,
+	token.AND:             LOGICAL_AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 type (
@@ -39,24 +62,45 @@ type (
 )
 
 type Parser struct {
-	l      *lexer.Lexer
-	errors []string
+	l           *lexer.Lexer
+	diagnostics []Diagnostic
+	// blockDepth is the number of blocks being parsed, see synchronize
+	blockDepth int
+	// loopControls are the break and continue statements parsed in the innermost loop or function
+	// body that aren't inside an if expression yet, see parseIfExpression
+	loopControls []token.Token
+	// statementIf is set when the expression being parsed starts an expression statement with 'if'
+	statementIf bool
 
 	curToken  token.Token
 	peekToken token.Token
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+	// precedences is the precedence of the infix operators, prefixPrecedences the one an operand of
+	// a prefix operator is parsed with, PREFIX if it's missing
+	precedences       map[token.TokenType]int
+	prefixPrecedences map[token.TokenType]int
+	rightAssociative  map[token.TokenType]bool
+	// operators are the infix operators declared in the source or with DeclareInfixOperator
+	operators []InfixOperator
 }
 
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l: l,
+		l:                 l,
+		precedences:       make(map[token.TokenType]int, len(defaultPrecedences)),
+		prefixPrecedences: make(map[token.TokenType]int),
+		rightAssociative:  make(map[token.TokenType]bool),
+	}
+	for tokenType, precedence := range defaultPrecedences {
+		p.precedences[tokenType] = precedence
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(token.FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(token.IF, p.parseIfExpression)
@@ -65,33 +109,119 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.STRING_START, p.parseInterpolatedString)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.ERROR, p.parseErrorToken)
 
 	// register infix parsing functions
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseArrayAccessExpression)
-
-	p.nextToken()
-	p.nextToken()
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 	return p
 }
 
+// RegisterInfixOperator makes tokens of type tokenType a binary operator parsed into an
+// *ast.InfixExpression, or changes the precedence and associativity of an existing one. An operator
+// with a new symbol must also be added to the lexer with lexer.AddOperator.
+func (p *Parser) RegisterInfixOperator(tokenType token.TokenType, precedence int, associativity Associativity) {
+	p.precedences[tokenType] = precedence
+	p.rightAssociative[tokenType] = associativity == RightAssociative
+	p.registerInfix(tokenType, p.parseInfixExpression)
+}
+
+// RegisterPrefixOperator makes tokens of type tokenType a unary operator parsed into an
+// *ast.PrefixExpression, its operand is parsed with precedence, e.g. PREFIX like '-' and '!'.
+// An operator with a new symbol must also be added to the lexer with lexer.AddOperator.
+func (p *Parser) RegisterPrefixOperator(tokenType token.TokenType, precedence int) {
+	p.prefixPrecedences[tokenType] = precedence
+	p.registerPrefix(tokenType, p.parsePrefixExpression)
+}
+
+// Errors returns the messages of the error diagnostics.
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := []string{}
+	for _, d := range p.diagnostics {
+		if d.Severity == SeverityError {
+			errors = append(errors, d.Message)
+		}
+	}
+	return errors
+}
+
+func (p *Parser) Diagnostics() []Diagnostic {
+	return p.diagnostics
+}
+
+// errorAt reports an error spanning pos to end, an error at the same position as the previous
+// one is dropped since it's most likely caused by it.
+func (p *Parser) errorAt(pos token.Position, end token.Position, format string, a ...interface{}) {
+	if n := len(p.diagnostics); n > 0 && p.diagnostics[n-1].Pos == pos {
+		return
+	}
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Severity: SeverityError,
+		Pos:      pos,
+		End:      end,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// addError reports an error at tok.
+func (p *Parser) addError(tok token.Token, format string, a ...interface{}) {
+	p.errorAt(tok.Pos, tok.End, format, a...)
+}
+
+// peekError reports that the peek token isn't the expected one, context tells where it was expected.
+func (p *Parser) peekError(expected string, context string) {
+	p.addError(p.peekToken, "expected %s %s, got %s", expected, context, describeToken(p.peekToken))
 }
 
-func (p *Parser) addError(format string, a ...interface{}) {
-	p.errors = append(p.errors, fmt.Sprintf(format, a...))
+// synchronize skips the rest of a statement that has an error, so the parser can carry on with
+// the next statement instead of reporting errors caused by the first one. It stops at the ';' ending
+// the statement, or before the keyword starting the next one, or before the '}' closing the enclosing
+// block. Braces opened in the skipped tokens are skipped up to the matching '}'.
+func (p *Parser) synchronize() {
+	depth := 0
+	for !p.curTokenIs(token.EOF) {
+		switch {
+		case p.curTokenIs(token.LBRACE):
+			depth++
+		case p.curTokenIs(token.RBRACE) && depth > 0:
+			depth--
+		case p.curTokenIs(token.SEMICOLON) && depth == 0:
+			return
+		}
+		if depth == 0 {
+			switch p.peekToken.Type {
+			case token.LET, token.RETURN, token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.EOF:
+				return
+			case token.RBRACE:
+				if p.blockDepth > 0 {
+					return
+				}
+			}
+		}
+		p.nextToken()
+	}
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -102,9 +232,17 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
+// nextToken skips comments, and reports the errors of malformed tokens. Malformed tokens are kept,
+// they parse as a missing expression so that e.g. a bad string doesn't also report a missing operand.
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.peekToken = p.l.NextToken()
+	}
+	if p.peekToken.Type == token.ERROR {
+		p.addError(p.peekToken, "%s", p.peekToken.Literal)
+	}
 }
 
 // @problem: this should be called curTokenTypeIs
@@ -119,12 +257,11 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 		p.nextToken()
 		return true
 	} else {
-		fmt.Printf("expect peek error, expect: '%s' got: '%s'\n", t, p.peekToken.Type)
 		return false
 	}
 }
 func (p *Parser) peekPrecedence() int {
-	if pre, ok := precedences[p.peekToken.Type]; ok {
+	if pre, ok := p.precedences[p.peekToken.Type]; ok {
 		return pre
 	}
 	// default precedence is LOWEST
@@ -132,18 +269,22 @@ func (p *Parser) peekPrecedence() int {
 }
 
 func (p *Parser) curPrecedence() int {
-	if pre, ok := precedences[p.curToken.Type]; ok {
+	if pre, ok := p.precedences[p.curToken.Type]; ok {
 		return pre
 	}
 	// default precedence is LOWEST
 	return LOWEST
 }
 
+// ParseProgram parses the whole input of the lexer. The parser reads no tokens before, so operators
+// can be registered or declared between New and ParseProgram.
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
+	p.nextToken()
+	p.nextToken()
 	for !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
+		stmt := p.parseStatementOrSynchronize()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
@@ -152,69 +293,187 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// parseStatementOrSynchronize parses a statement and skips what's left of it if it has an error.
+func (p *Parser) parseStatementOrSynchronize() ast.Statement {
+	numDiagnostics := len(p.diagnostics)
+	stmt := p.parseStatement()
+	if len(p.diagnostics) > numDiagnostics {
+		p.synchronize()
+	}
+	return stmt
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForInStatement()
+	case token.BREAK:
+		stmt := &ast.BreakStatement{Token: p.curToken}
+		p.loopControls = append(p.loopControls, p.curToken)
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	case token.CONTINUE:
+		stmt := &ast.ContinueStatement{Token: p.curToken}
+		p.loopControls = append(p.loopControls, p.curToken)
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	case token.IDENT:
+		// infix is only a keyword in front of a precedence, so it's still a valid identifier
+		if p.curToken.Literal == "infix" && p.peekTokenIs(token.INT) {
+			return p.parseInfixDeclaration()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+func (p *Parser) parseLetStatement() ast.Statement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 	if !p.expectPeek(token.IDENT) {
-		msg := fmt.Sprintf("parsing let statement error: the token after 'let' is not an identifier but: %s", p.peekToken)
-		p.errors = append(p.errors, msg)
+		p.peekError("an identifier", "after 'let'")
 		return nil
 	}
 
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	if !p.expectPeek(token.ASSIGN) {
-		msg := fmt.Sprintf("parsing let statement error: the token after identifier is not '=' but: %s", p.peekToken)
-		p.errors = append(p.errors, msg)
+		p.peekError("'='", "after the name in a let statement")
 		return nil
 	}
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
 }
 
-func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+func (p *Parser) parseReturnStatement() ast.Statement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 	p.nextToken()
 	stmt.ReturnValue = p.parseExpression(LOWEST)
+	if stmt.ReturnValue == nil {
+		return nil
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		p.peekError("'('", "after 'while'")
+		return nil
+	}
+	stmt.Condition = p.parseLParen()
+	if stmt.Condition == nil {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		p.peekError("'{'", "after the loop condition")
+		return nil
+	}
+	stmt.Body = p.parseBody()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseForInStatement() ast.Statement {
+	stmt := &ast.ForInStatement{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		p.peekError("'('", "after 'for'")
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		p.peekError("a loop variable", "in a for statement")
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.IN) {
+		p.peekError("'in'", "after the loop variable")
+		return nil
+	}
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+	if stmt.Iterable == nil {
+		return nil
+	}
+	if !p.expectPeek(token.RPAREN) {
+		p.peekError("')'", "after the iterable")
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		p.peekError("'{'", "after the for clause")
+		return nil
+	}
+	stmt.Body = p.parseBody()
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
 }
 
+// parseIfExpression parses an if expression. A break or continue may only leave it when it's
+// a statement, i.e. its value isn't used: the engines can't jump out of the evaluation of an
+// operand. Whether an operator follows is only known at the end, so the break and continue
+// statements in the blocks are checked then.
 func (p *Parser) parseIfExpression() ast.Expression {
 	exp := &ast.IfExpression{Token: p.curToken}
+	isStatement := p.statementIf
+	p.statementIf = false
+	outerLoopControls := p.loopControls
+	p.loopControls = nil
+	defer func() {
+		if isStatement && p.peekPrecedence() == LOWEST {
+			p.loopControls = append(outerLoopControls, p.loopControls...)
+			return
+		}
+		for _, tok := range p.loopControls {
+			p.addError(tok, "%s can't jump out of an if expression whose value is used", tok.Literal)
+		}
+		p.loopControls = outerLoopControls
+	}()
 	if !p.expectPeek(token.LPAREN) {
-		msg := fmt.Sprintf("the token after if is not (, but: %s", p.peekToken)
-		p.errors = append(p.errors, msg)
+		p.peekError("'('", "after 'if'")
 		return nil
 	}
 	exp.Condition = p.parseLParen()
+	if exp.Condition == nil {
+		return nil
+	}
 	if !p.expectPeek(token.LBRACE) {
-		msg := fmt.Sprintf("the token after if condition expression is not {, but: %s", p.peekToken)
-		p.errors = append(p.errors, msg)
+		p.peekError("'{'", "after the if condition")
 		return nil
 	}
 	exp.Consequence = p.parseLbrace()
 	if !p.peekTokenIs(token.ELSE) {
 		return exp
 	} else {
-		// @Robustness: we should here also use expectPeek to check left brace token and else token
-		p.nextToken()
 		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			p.peekError("'{'", "after 'else'")
+			return nil
+		}
 		exp.Altenative = p.parseLbrace()
 	}
 	return exp
@@ -223,15 +482,18 @@ func (p *Parser) parseIfExpression() ast.Expression {
 func (p *Parser) parseFunctionExpression() ast.Expression {
 	exp := &ast.FunctionLiteral{Token: p.curToken}
 	if !p.expectPeek(token.LPAREN) {
-		p.addError("parsing function error: the token after if is not left paren, but: %s\n", p.peekToken)
+		p.peekError("'('", "after 'fn'")
 		return nil
 	}
 	exp.Parameters = p.parseFunctionParameters()
+	if exp.Parameters == nil {
+		return nil
+	}
 	if !p.expectPeek(token.LBRACE) {
-		p.addError("parsing function error: the token after function parameter is not '{', but: %s\n", p.peekToken)
+		p.peekError("'{'", "after the function parameters")
 		return nil
 	}
-	exp.Body = p.parseLbrace()
+	exp.Body = p.parseBody()
 	return exp
 }
 
@@ -242,42 +504,65 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		p.nextToken()
 		return parameters
 	}
-	// skip '(' token
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		p.peekError("a parameter name", "in the function parameters")
+		return nil
+	}
 	par := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	parameters = append(parameters, par)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			p.peekError("a parameter name", "after ','")
+			return nil
+		}
 		par := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 		parameters = append(parameters, par)
 	}
 	if !p.expectPeek(token.RPAREN) {
-		msg := fmt.Sprintf("parsing function error: the token after prameters is not ')', but: %s", p.peekToken)
-		p.errors = append(p.errors, msg)
+		p.peekError("')'", "after the function parameters")
 		return nil
 	}
 	return parameters
 }
 
+// parseBody parses the body of a loop or function, the break and continue statements in it
+// don't leave the if expressions around it.
+func (p *Parser) parseBody() *ast.BlockStatement {
+	outerLoopControls := p.loopControls
+	p.loopControls = nil
+	defer func() { p.loopControls = outerLoopControls }()
+	return p.parseLbrace()
+}
+
 func (p *Parser) parseLbrace() *ast.BlockStatement {
-	block := &ast.BlockStatement{}
+	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
 	p.nextToken()
-	for !p.curTokenIs(token.RBRACE) {
-		stmt := p.parseStatement()
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatementOrSynchronize()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
 	}
+	if p.curTokenIs(token.EOF) {
+		p.addError(p.curToken, "expected '}' to close the block opened at %s, got end of input", block.Token.Pos)
+	}
+	block.Rbrace = p.curToken
 	return block
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+func (p *Parser) parseExpressionStatement() ast.Statement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	p.statementIf = p.curTokenIs(token.IF)
 	stmt.Expression = p.parseExpression(LOWEST)
+	if stmt.Expression == nil {
+		return nil
+	}
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -290,6 +575,10 @@ func (p *Parser) parseCallExpression(left ast.Expression) ast.Expression {
 		Function: left,
 	}
 	exp.Arguments = p.parseCallArguments()
+	if exp.Arguments == nil {
+		return nil
+	}
+	exp.Rparen = p.curToken
 	return exp
 }
 
@@ -302,16 +591,21 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 	// skip '(' token
 	p.nextToken()
 	arg := p.parseExpression(LOWEST)
+	if arg == nil {
+		return nil
+	}
 	args = append(args, arg)
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
 		arg = p.parseExpression(LOWEST)
+		if arg == nil {
+			return nil
+		}
 		args = append(args, arg)
 	}
 	if !p.expectPeek(token.RPAREN) {
-		msg := fmt.Sprintf("parsing call error: the token after arguments is not ')' but: %s", p.peekToken)
-		p.errors = append(p.errors, msg)
+		p.peekError("')'", "after the call arguments")
 		return nil
 	}
 	return args
@@ -320,10 +614,13 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
-		p.addError("no function for parsing token of type %s", p.curToken.Type)
+		p.addError(p.curToken, "expected an expression, got %s", describeToken(p.curToken))
 		return nil
 	}
 	leftExp := prefix()
+	if leftExp == nil {
+		return nil
+	}
 	// @Logic: the for loop condition could cause a problem when prefix() is for parsing if or fn expression,
 	// because there is no semicolon after the expression and might go into the for loop, which is not
 	// what we want to see.
@@ -342,7 +639,7 @@ func (p *Parser) parseLParen() ast.Expression {
 	p.nextToken()
 	exp := p.parseExpression(LOWEST)
 	if !p.expectPeek(token.RPAREN) {
-		p.addError("parsing left paren expession: the token after expression is not ')' but: %s\n", p.peekToken)
+		p.peekError("')'", "after the parenthesized expression")
 		return nil
 	}
 	return exp
@@ -355,15 +652,31 @@ func (p *Parser) parseIdentifier() ast.Expression {
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	value, err := parseInteger(p.curToken.Literal)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %s as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, "%s", err)
+		return nil
+	}
+	// a literal too large for an int64 becomes a big integer
+	if value.IsInt64() {
+		lit.Value = value.Int64()
+	} else {
+		lit.Big = value
+	}
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+	value, err := parseFloat(p.curToken.Literal)
+	if err != nil {
+		p.addError(p.curToken, "%s", err)
 		return nil
 	}
 	lit.Value = value
 	return lit
 }
+
 func (p *Parser) parseBooleanLiteral() ast.Expression {
 	lit := &ast.BooleanLiteral{Token: p.curToken}
 	var val bool
@@ -382,24 +695,61 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken, Parts: []ast.Expression{}}
+	for {
+		if p.curToken.Literal != "" {
+			str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+		}
+		if p.curTokenIs(token.STRING_END) {
+			str.Tail = p.curToken
+			return str
+		}
+		p.nextToken()
+		expr := p.parseExpression(LOWEST)
+		if expr == nil {
+			return nil
+		}
+		str.Parts = append(str.Parts, expr)
+		if !p.peekTokenIs(token.STRING_MIDDLE) && !p.peekTokenIs(token.STRING_END) {
+			p.peekError("'}'", "to close the interpolation")
+			return nil
+		}
+		p.nextToken()
+	}
+}
+
+// parseErrorToken parses a malformed token, its error was reported when it was read.
+func (p *Parser) parseErrorToken() ast.Expression {
+	return nil
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	arr := &ast.ArrayLiteral{Token: p.curToken, Elements: []ast.Expression{}}
 	// empty array
 	if p.peekTokenIs(token.RBRACKET) {
 		p.nextToken()
+		arr.Rbracket = p.curToken
 		return arr
 	}
-	// skip '[' token
-	p.nextToken()
-	arr.Elements = append(arr.Elements, p.parseExpression(LOWEST))
-	for p.peekTokenIs(token.COMMA) {
+	for {
+		// skip '[' or ',' token
 		p.nextToken()
+		elem := p.parseExpression(LOWEST)
+		if elem == nil {
+			return nil
+		}
+		arr.Elements = append(arr.Elements, elem)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		arr.Elements = append(arr.Elements, p.parseExpression(LOWEST))
 	}
 	if !p.expectPeek(token.RBRACKET) {
-		p.addError("parsing array literal error, expect ] as the end of exrepssion, but got %s\n", p.peekToken)
+		p.peekError("']'", "at the end of the array literal")
+		return nil
 	}
+	arr.Rbracket = p.curToken
 	return arr
 }
 
@@ -408,34 +758,72 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
+		if key == nil {
+			return nil
+		}
 		if !p.expectPeek(token.COLON) {
-			p.addError("parsing hash literal error, expect colon token ':' , but got %s\n", p.peekToken)
+			p.peekError("':'", "after the hash key")
+			return nil
 		}
 		p.nextToken()
 		val := p.parseExpression(LOWEST)
+		if val == nil {
+			return nil
+		}
 		hash.Pairs[key] = val
-		// skip comma if it exists
-		if p.peekTokenIs(token.COMMA) {
-			p.nextToken()
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			p.peekError("',' or '}'", "after the hash value")
+			return nil
 		}
 	}
-	// skip '{'
+	// skip to '}'
 	p.nextToken()
+	hash.Rbrace = p.curToken
 	return hash
 }
 
 func (p *Parser) parseArrayAccessExpression(left ast.Expression) ast.Expression {
 	ac := &ast.ArrayAccessExpression{Token: p.curToken, Array: left}
-	if !p.expectPeek(token.INT) {
-		p.addError("parsing array access error, expect integer as index, but got %s\n", p.peekToken)
+	// the start of a slice may be omitted
+	if !p.peekTokenIs(token.COLON) {
+		// skip '[' token
+		p.nextToken()
+		ac.Index = p.parseExpression(LOWEST)
+		if ac.Index == nil {
+			return nil
+		}
+	}
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(ac.Token, left, ac.Index)
 	}
-	ac.Index = p.parseIntegerLiteral()
 	if !p.expectPeek(token.RBRACKET) {
-		p.addError("parsing array access error, expect ] as the end of expression, but got %s\n", p.peekToken)
+		p.peekError("']'", "after the index")
+		return nil
 	}
+	ac.Rbracket = p.curToken
 	return ac
 }
 
+// parseSliceExpression is called with the ':' as current token.
+func (p *Parser) parseSliceExpression(tok token.Token, left ast.Expression, low ast.Expression) ast.Expression {
+	slice := &ast.SliceExpression{Token: tok, Left: left, Low: low}
+	if !p.peekTokenIs(token.RBRACKET) {
+		// skip ':' token
+		p.nextToken()
+		slice.High = p.parseExpression(LOWEST)
+		if slice.High == nil {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		p.peekError("']'", "after the slice bounds")
+		return nil
+	}
+	slice.Rbracket = p.curToken
+	return slice
+}
+
 // @Problem: the function name is really confusing, parsePrefixExpression is one of a group of functions
 // and the group itself is called prefixParseFns.
 func (p *Parser) parsePrefixExpression() ast.Expression {
@@ -443,8 +831,15 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 		Token:    p.curToken,
 		Operator: p.curToken.Literal,
 	}
+	precedence, ok := p.prefixPrecedences[p.curToken.Type]
+	if !ok {
+		precedence = PREFIX
+	}
 	p.nextToken()
-	expression.Right = p.parseExpression(LOWEST)
+	expression.Right = p.parseExpression(precedence)
+	if expression.Right == nil {
+		return nil
+	}
 	return expression
 }
 
@@ -455,8 +850,43 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		Left:     left,
 	}
 
-	precedence := p.curPrecedence()
+	precedence := p.rightOperandPrecedence()
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
+	if expression.Right == nil {
+		return nil
+	}
 	return expression
 }
+
+// rightOperandPrecedence is the precedence the right operand of the current infix operator is parsed
+// with, for a right associative operator the operand takes the next operator of the same precedence:
+// a ** b ** c is a ** (b ** c).
+func (p *Parser) rightOperandPrecedence() int {
+	precedence := p.curPrecedence()
+	if p.rightAssociative[p.curToken.Type] {
+		precedence--
+	}
+	return precedence
+}
+
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	exp := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Target:   left,
+	}
+	switch left.(type) {
+	case *ast.Identifier, *ast.ArrayAccessExpression:
+	default:
+		p.errorAt(left.Pos(), left.End(), "invalid assignment target: %s", left)
+		return nil
+	}
+	p.nextToken()
+	// assignment is right associative: a = b = c is a = (b = c)
+	exp.Value = p.parseExpression(ASSIGN - 1)
+	if exp.Value == nil {
+		return nil
+	}
+	return exp
+}
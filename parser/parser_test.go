@@ -0,0 +1,474 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/token"
+	"testing"
+)
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := New(lexer.New("", input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has %d errors: %q", len(p.Errors()), p.Errors())
+	}
+	return program
+}
+
+func TestNodeSpans(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   string
+		end   string
+	}{
+		{"foo", "1:1", "1:4"},
+		{"1 + 2 * 3", "1:1", "1:10"},
+		{"-x", "1:1", "1:3"},
+		{"add(1, 2)", "1:1", "1:10"},
+		{"add()", "1:1", "1:6"},
+		{"[1, 2]", "1:1", "1:7"},
+		{"arr[1]", "1:1", "1:7"},
+		{"arr[1:]", "1:1", "1:8"},
+		{`{"a": 1}`, "1:1", "1:9"},
+		{"x = y + 1", "1:1", "1:10"},
+		{"fn(x) {\n  x\n}", "1:1", "3:2"},
+		{"if (x) { 1 } else { 2 }", "1:1", "1:24"},
+		{"if (x) { 1 }", "1:1", "1:13"},
+		{"let x = 5;", "1:1", "1:10"},
+		{"return 5;", "1:1", "1:9"},
+		{"while (x) { }", "1:1", "1:14"},
+		{"for (x in xs) {\n}", "1:1", "2:2"},
+		{"break;", "1:1", "1:6"},
+		{"a;\nb", "1:1", "2:2"},
+	}
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		if program.Pos().String() != tt.pos {
+			t.Errorf("%q: wrong position. want=%s, got=%s", tt.input, tt.pos, program.Pos())
+		}
+		if program.End().String() != tt.end {
+			t.Errorf("%q: wrong end. want=%s, got=%s", tt.input, tt.end, program.End())
+		}
+	}
+}
+
+func TestNestedNodeSpans(t *testing.T) {
+	program := parseProgram(t, "let f = fn(a, b) {\n  a + b * 10\n};")
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	body := fn.Body.Statements[0].(*ast.ExpressionStatement)
+	add := body.Expression.(*ast.InfixExpression)
+	mul := add.Right.(*ast.InfixExpression)
+
+	tests := []struct {
+		node ast.Node
+		pos  string
+		end  string
+	}{
+		{let.Name, "1:5", "1:6"},
+		{fn, "1:9", "3:2"},
+		{fn.Parameters[1], "1:15", "1:16"},
+		{fn.Body, "1:18", "3:2"},
+		{add, "2:3", "2:13"},
+		{mul, "2:7", "2:13"},
+	}
+	for _, tt := range tests {
+		if tt.node.Pos().String() != tt.pos || tt.node.End().String() != tt.end {
+			t.Errorf("%s: wrong span. want=%s-%s, got=%s-%s", tt.node, tt.pos, tt.end, tt.node.Pos(), tt.node.End())
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"let = 5;\nlet y = ;\nlet z = 3 +;\nputs(z)",
+			[]string{
+				"1:5: error: expected an identifier after 'let', got '='",
+				"2:9: error: expected an expression, got ';'",
+				"3:12: error: expected an expression, got ';'",
+			},
+		},
+		{
+			"let f = fn(x {\n  x\n};\nlet y = 1;",
+			[]string{"1:14: error: expected ')' after the function parameters, got '{'"},
+		},
+		{
+			"if (x { 1 } else { 2 }\nlet a = [1, 2;\nlet b = {1 2};",
+			[]string{
+				"1:7: error: expected ')' after the parenthesized expression, got '{'",
+				"2:14: error: expected ']' at the end of the array literal, got ';'",
+				"3:12: error: expected ':' after the hash key, got '2'",
+			},
+		},
+		{
+			"let f = fn() { let = 1; let y = ); y };\nlet g = ",
+			[]string{
+				"1:20: error: expected an identifier after 'let', got '='",
+				"1:33: error: expected an expression, got ')'",
+				"2:9: error: expected an expression, got end of input",
+			},
+		},
+		{"let x = fn() {", []string{"1:15: error: expected '}' to close the block opened at 1:14, got end of input"}},
+		{`foo(1, "a" 3)`, []string{"1:12: error: expected ')' after the call arguments, got '3'"}},
+		{"while (x) { 1 & 2 }", []string{"1:15: error: expected an expression, got illegal character '&'"}},
+		{"5 = 3", []string{"1:1: error: invalid assignment target: 5"}},
+		{"fn(a, 1) { a }", []string{"1:7: error: expected a parameter name after ',', got '1'"}},
+		{"let a = 1; /* never closed", []string{"1:12: error: unterminated block comment"}},
+		{"let a = /* comment */ ; // comment", []string{"1:23: error: expected an expression, got ';'"}},
+		{`let s = "a\qb"; let t = s + 1;`, []string{`1:9: error: unknown escape sequence \q`}},
+		{`puts("ok", "\u{110000}")`, []string{`1:12: error: invalid unicode escape \u{110000}`}},
+		{"let s = 1;\nlet t = \"abc;", []string{"2:9: error: unterminated string"}},
+		{"let s = `raw", []string{"1:9: error: unterminated raw string"}},
+		{`"a ${x y} b"; z`, []string{"1:8: error: expected '}' to close the interpolation, got 'y'"}},
+		{`"a ${} b"`, []string{"1:6: error: expected an expression, got '}'"}},
+		{`"a ${x`, []string{"1:7: error: expected '}' to close the interpolation, got end of input"}},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New("", tt.input))
+		p.ParseProgram()
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("%q: wrong number of diagnostics. want=%d, got=%d %v", tt.input, len(tt.expected), len(diagnostics), diagnostics)
+			continue
+		}
+		for i, d := range diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("%q: wrong diagnostic. want=%q, got=%q", tt.input, tt.expected[i], d)
+			}
+		}
+		if len(p.Errors()) != len(diagnostics) || p.Errors()[0] != diagnostics[0].Message {
+			t.Errorf("%q: Errors() doesn't match the diagnostics: %q", tt.input, p.Errors())
+		}
+	}
+}
+
+func TestLoopControlsInIfExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"for (x in [1]) { [1, if (true) { continue; }] }", []string{"1:34: error: continue can't jump out of an if expression whose value is used"}},
+		{"while (true) { puts(if (true) { continue; }) }", []string{"1:33: error: continue can't jump out of an if expression whose value is used"}},
+		{"while (true) { if (true) { break; } + 1 }", []string{"1:28: error: break can't jump out of an if expression whose value is used"}},
+		{"while (true) { let x = if (true) { break; } else { 1 }; }", []string{"1:36: error: break can't jump out of an if expression whose value is used"}},
+		{"while (true) { [if (true) { if (true) { break; } }] }", []string{"1:41: error: break can't jump out of an if expression whose value is used"}},
+		{"for (x in [1]) { if (x) { if (x) { break; } } else { continue; } }", nil},
+		{"[if (true) { while (true) { break; } }]", nil},
+		{"while (true) { puts(fn() { if (true) { 1 } }); break; }", nil},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New("", tt.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Errorf("%q: wrong number of diagnostics. want=%d, got=%d %v", tt.input, len(tt.expected), len(errors), p.Diagnostics())
+			continue
+		}
+		for i, d := range p.Diagnostics() {
+			if d.String() != tt.expected[i] {
+				t.Errorf("%q: wrong diagnostic. want=%q, got=%q", tt.input, tt.expected[i], d)
+			}
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		source     string
+		diagnostic Diagnostic
+		expected   string
+	}{
+		{
+			"let x = 1;\nlet y = x +* 2;",
+			Diagnostic{
+				Pos:     token.Position{Offset: 22, Line: 2, Column: 12},
+				End:     token.Position{Offset: 23, Line: 2, Column: 13},
+				Message: "expected an expression, got '*'",
+			},
+			"2:12: error: expected an expression, got '*'\n" +
+				"let y = x +* 2;\n" +
+				"           ^\n",
+		},
+		{
+			"\tfoo(bar)",
+			Diagnostic{
+				Severity: SeverityWarning,
+				Pos:      token.Position{Filename: "a.mk", Offset: 5, Line: 1, Column: 6},
+				End:      token.Position{Filename: "a.mk", Offset: 8, Line: 1, Column: 9},
+				Message:  "unused",
+			},
+			"a.mk:1:6: warning: unused\n" +
+				"\tfoo(bar)\n" +
+				"\t    ^^^\n",
+		},
+		{
+			"x = \"é\" + fn() {\n}",
+			Diagnostic{
+				Pos:     token.Position{Offset: 11, Line: 1, Column: 10},
+				End:     token.Position{Offset: 20, Line: 2, Column: 2},
+				Message: "spans lines",
+			},
+			"1:10: error: spans lines\n" +
+				"x = \"é\" + fn() {\n" +
+				"          ^^^^^^\n",
+		},
+	}
+	for _, tt := range tests {
+		rendered := Render(tt.diagnostic, tt.source)
+		if rendered != tt.expected {
+			t.Errorf("wrong rendering.\nwant=\n%s\ngot=\n%s", tt.expected, rendered)
+		}
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		parts    int
+	}{
+		{`"total: ${a + b}"`, `"total: ${(a+b)}"`, 2},
+		{`"${a}${b}"`, `"${a}${b}"`, 2},
+		{`"x ${ {"k": "${v}"}["k"] } y"`, `"x ${{k(tok):"${v}"}[k(tok)]} y"`, 3},
+		{`"a\${b}"`, `a${b}(tok)`, 0},
+	}
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("%s: wrong expression. want=%s, got=%s", tt.input, tt.expected, stmt.Expression.String())
+		}
+		if str, ok := stmt.Expression.(*ast.InterpolatedString); ok && len(str.Parts) != tt.parts {
+			t.Errorf("%s: wrong number of parts. want=%d, got=%d", tt.input, tt.parts, len(str.Parts))
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"0", int64(0)},
+		{"1_000_000", int64(1000000)},
+		{"0xFF", int64(255)},
+		{"0Xdead_beef", int64(0xdeadbeef)},
+		{"0o17", int64(15)},
+		{"0b1010", int64(10)},
+		{"0b_1010_1010", int64(170)},
+		{"0x1_0000_0000_0000_0000", "18446744073709551616"},
+		{"1_000.5", 1000.5},
+		{"1e1_0", 1e10},
+		{"0.5", 0.5},
+		{"00.5", 0.5},
+	}
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		expr := program.Statements[0].(*ast.ExpressionStatement).Expression
+		switch expected := tt.expected.(type) {
+		case int64:
+			lit, ok := expr.(*ast.IntegerLiteral)
+			if !ok || lit.Big != nil || lit.Value != expected {
+				t.Errorf("%s: wrong literal. want=%d, got=%#v", tt.input, expected, expr)
+			}
+		case string:
+			lit, ok := expr.(*ast.IntegerLiteral)
+			if !ok || lit.Big == nil || lit.Big.String() != expected {
+				t.Errorf("%s: wrong literal. want=%s, got=%#v", tt.input, expected, expr)
+			}
+		case float64:
+			lit, ok := expr.(*ast.FloatLiteral)
+			if !ok || lit.Value != expected {
+				t.Errorf("%s: wrong literal. want=%g, got=%#v", tt.input, expected, expr)
+			}
+		}
+	}
+}
+
+func TestMalformedNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0x", "hexadecimal literal 0x has no digits"},
+		{"0o19", "invalid digit '9' in octal literal 0o19"},
+		{"0b102", "invalid digit '2' in binary literal 0b102"},
+		{"0xFG", "invalid digit 'G' in hexadecimal literal 0xFG"},
+		{"12ab", "invalid digit 'a' in decimal literal 12ab"},
+		{"017", "invalid decimal literal 017, leading zeros aren't allowed, octal literals start with 0o"},
+		{"1__000", "'_' must separate successive digits in 1__000"},
+		{"1000_", "'_' must separate successive digits in 1000_"},
+		{"0x_", "'_' must separate successive digits in 0x_"},
+		{"1_.5", "'_' must separate successive digits in 1_.5"},
+		{"1.5x", "invalid character 'x' in float literal 1.5x"},
+		{"1e5e3", "malformed float literal 1e5e3"},
+		{"1e999", "float literal 1e999 overflows FLOAT"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New("", tt.input+";"))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expected {
+			t.Errorf("%s: wrong errors. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"-a + b", "((-a)+b)"},
+		{"-a - b", "((-a)-b)"},
+		{"!x == y", "((!x)==y)"},
+		{"-a * b", "((-a)*b)"},
+		{"!-a", "(!(-a))"},
+		{"-f(x)", "(-f(x,))"},
+		{"-a[0] + 1", "((-a[0])+1)"},
+		{"a + b * c - d", "((a+(b*c))-d)"},
+		{"a - b - c", "((a-b)-c)"},
+		{"a || b && c == d < e + f * g", "(a||(b&&(c==(d<(e+(f*g))))))"},
+		{"f(a)[1](b)", "f(a,)[1](b,)"},
+	}
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		if actual := program.Statements[0].String(); actual != tt.expected {
+			t.Errorf("%s: wrong grouping. want=%s, got=%s", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestRegisterOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 ** 3 ** 2 * 4", "((2**(3**2))*4)"},
+		{"2 * 3 ** 2", "(2*(3**2))"},
+		{"-2 ** 2", "((-2)**2)"},
+		{"~a + b", "((~a)+b)"},
+		{"x |> f |> g", "((x|>f)|>g)"},
+		{"a |> b == c", "(a|>(b==c))"},
+		{"a - b - c", "(a-(b-c))"},
+	}
+	for _, tt := range tests {
+		l := lexer.New("", tt.input)
+		l.AddOperator("**")
+		l.AddOperator("~")
+		l.AddOperator("|>")
+		p := New(l)
+		p.RegisterInfixOperator("**", PRODUCT+5, RightAssociative)
+		p.RegisterInfixOperator("|>", LOWEST+5, LeftAssociative)
+		p.RegisterPrefixOperator("~", PREFIX)
+		p.RegisterInfixOperator(token.MINUS, SUM, RightAssociative)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%s: parser has errors: %q", tt.input, p.Errors())
+		}
+		if actual := program.Statements[0].String(); actual != tt.expected {
+			t.Errorf("%s: wrong grouping. want=%s, got=%s", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestRegisteredOperatorsArePerParser(t *testing.T) {
+	p := New(lexer.New("", "a - b - c"))
+	p.RegisterInfixOperator(token.MINUS, SUM, RightAssociative)
+	p.ParseProgram()
+
+	program := parseProgram(t, "a - b - c")
+	if actual := program.Statements[0].String(); actual != "((a-b)-c)" {
+		t.Errorf("registering an operator changed other parsers. want=((a-b)-c), got=%s", actual)
+	}
+}
+
+func TestInfixDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"infix 60 left <> = fn(a, b) { a }; x <> y <> z", "((x<>y)<>z)"},
+		{"infix 60 right <> = fn(a, b) { a }; x <> y <> z", "(x<>(y<>z))"},
+		{"infix 65 left |+| = fn(a, b) { a }; a + b |+| c * d", "((a+b)|+|(c*d))"},
+		{"infix 75 left |+| = fn(a, b) { a }; a + b |+| c * d", "(a+(b|+|(c*d)))"},
+		{"infix 60 left <=> = fn(a, b) { a }; a <= b <=> c", "((a<=b)<=>c)"},
+		{"infix 60 left ** = fn(a, b) { a }; -a ** f(b)", "((-a)**f(b,))"},
+		{"let infix = 1; infix + 1", "(infix+1)"},
+	}
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		last := program.Statements[len(program.Statements)-1]
+		if last.String() != tt.expected {
+			t.Errorf("%s: wrong expression. want=%s, got=%s", tt.input, tt.expected, last.String())
+		}
+	}
+}
+
+func TestInfixDeclarationDesugaring(t *testing.T) {
+	input := "infix 60 left <> = fn(a, b) { a };\na <> b"
+	program := parseProgram(t, input)
+	let, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok || let.Name.Value != "(<>)" {
+		t.Fatalf("declaration isn't a let statement binding (<>). got=%#v", program.Statements[0])
+	}
+	if fl, ok := let.Value.(*ast.FunctionLiteral); !ok || fl.Name != "(<>)" {
+		t.Errorf("function isn't named (<>). got=%#v", let.Value)
+	}
+	call, ok := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("use isn't a call. got=%#v", program.Statements[1])
+	}
+	if fn, ok := call.Function.(*ast.Identifier); !ok || fn.Value != "(<>)" || len(call.Arguments) != 2 {
+		t.Errorf("wrong call. got=%s", call)
+	}
+	if call.Pos().String() != "2:1" || call.End().String() != "2:7" {
+		t.Errorf("wrong span. want=2:1-2:7, got=%s-%s", call.Pos(), call.End())
+	}
+}
+
+func TestDeclareInfixOperator(t *testing.T) {
+	first := New(lexer.New("", "infix 60 right <> = fn(a, b) { a }"))
+	first.ParseProgram()
+	p := New(lexer.New("", "a <> b <> c"))
+	for _, op := range first.InfixOperators() {
+		p.DeclareInfixOperator(op)
+	}
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors: %q", p.Errors())
+	}
+	if actual := program.String(); actual != "(a<>(b<>c))" {
+		t.Errorf("wrong expression. want=(a<>(b<>c)), got=%s", actual)
+	}
+}
+
+func TestMalformedInfixDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"infix 5 left <> = f", "1:7: error: the precedence of an infix operator must be between 11 and 89, got 5"},
+		{"infix 90 left <> = f", "1:7: error: the precedence of an infix operator must be between 11 and 89, got 90"},
+		{"infix 60 up <> = f", "1:10: error: expected 'left' or 'right' after the precedence of the operator, got 'up'"},
+		{"infix 60 left abc = f", "1:15: error: expected an operator symbol after the associativity of the operator, got 'abc'"},
+		{"infix 60 left + = f", "1:15: error: can't declare the built-in operator +"},
+		{"infix 60 left <>= f", "1:19: error: expected '=' after the operator symbol, got 'f'"},
+		{"infix 60 left <> = fn(a) { a }", "1:20: error: the function of an infix operator takes 2 parameters, got 1"},
+		{"let f = fn() { infix 60 left <> = g }", "1:16: error: infix operators can only be declared at the top level"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New("", tt.input))
+		p.ParseProgram()
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 || diagnostics[0].String() != tt.expected {
+			t.Errorf("%s: wrong diagnostics. want=%q, got=%v", tt.input, tt.expected, diagnostics)
+		}
+	}
+}
@@ -20,6 +20,11 @@ func Start(in io.Reader, out io.Writer) {
 	constants := []object.Object{}
 	globals := make([]object.Object, vm.GlobalSize)
 	symbolTable := compiler.NewSymbolTable()
+	// the infix operators declared by the previous inputs
+	operators := []parser.InfixOperator{}
+	for i, b := range object.Builtins {
+		symbolTable.DefineBuiltin(i, b.Name)
+	}
 
 	instruction := code.Make(code.Opconst, 65534)
 	for i, b := range instruction {
@@ -35,18 +40,30 @@ func Start(in io.Reader, out io.Writer) {
 		if line == "quit" || line == "exit" {
 			os.Exit(0)
 		}
-		l := lexer.New(line)
+		l := lexer.New("", line)
 		p := parser.New(l)
+		for _, op := range operators {
+			p.DeclareInfixOperator(op)
+		}
 		prog := p.ParseProgram()
+		if len(p.Diagnostics()) != 0 {
+			for _, d := range p.Diagnostics() {
+				io.WriteString(out, parser.Render(d, line))
+			}
+			continue
+		}
+		operators = p.InfixOperators()
 		comp := compiler.NewWithState(symbolTable, constants)
 		comp.Compile(prog, 0)
 		constants = comp.Bytecode().Constants
 		v := vm.NewWithGlobalsStore(comp.Bytecode(), globals)
-		v.Run()
-
-		// print error messages
-		for _, err := range p.Errors() {
-			fmt.Printf(err)
+		err := v.Run()
+		if err != nil {
+			fmt.Fprintf(out, "runtime error: %s\n", err)
+			if rtErr, ok := err.(*vm.RuntimeError); ok {
+				io.WriteString(out, rtErr.Trace.String())
+			}
+			continue
 		}
 		io.WriteString(out, v.LastPopped().Inspect())
 		io.WriteString(out, "\n")
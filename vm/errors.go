@@ -0,0 +1,115 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"monkey/code"
+	"strings"
+)
+
+// RuntimeError is the error returned by VM.Run, it records the instruction that failed
+// and the Monkey stack trace at that point.
+type RuntimeError struct {
+	Err error
+	// Opcode and Ip locate the failing instruction in the instructions of its function
+	Opcode code.Opcode
+	Ip     int
+	Trace  StackTrace
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Err.Error()
+}
+
+// TraceFrame is a function call in a stack trace, Line is 0 if the line is unknown.
+type TraceFrame struct {
+	Function string
+	Line     int
+}
+
+// StackTrace lists the calls active when a runtime error happened, innermost first.
+type StackTrace []TraceFrame
+
+// maxTraceLines is the number of lines String writes at most, the rest of a deep trace is cut.
+const maxTraceLines = 20
+
+// String returns the trace one call per line, e.g.
+//
+//	at divide (line 2)
+//	at <main> (line 5)
+//
+// Consecutive identical calls, e.g. of a recursion, are written once followed by the number of
+// repetitions.
+func (st StackTrace) String() string {
+	var out strings.Builder
+	lines := 0
+	for i := 0; i < len(st); i++ {
+		if lines == maxTraceLines {
+			fmt.Fprintf(&out, "\t... %d more calls\n", len(st)-i)
+			break
+		}
+		frame := st[i]
+		out.WriteString("\tat " + frame.Function)
+		if frame.Line > 0 {
+			fmt.Fprintf(&out, " (line %d)", frame.Line)
+		}
+		out.WriteString("\n")
+		lines++
+		repeated := 0
+		for i+1 < len(st) && st[i+1] == frame {
+			repeated++
+			i++
+		}
+		if repeated > 0 {
+			fmt.Fprintf(&out, "\t... repeated %d more times\n", repeated)
+			lines++
+		}
+	}
+	return out.String()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// errStackUnderflow is raised by pop on an empty stack, which only happens with malformed bytecode.
+var errStackUnderflow = errors.New("stack underflow")
+
+// newRuntimeError wraps err with the position of the instruction being executed.
+func (vm *VM) newRuntimeError(err error) *RuntimeError {
+	return &RuntimeError{Err: err, Opcode: vm.op, Ip: vm.opIp, Trace: vm.stackTrace()}
+}
+
+// stackTrace walks the frames from the current one down to the main one.
+func (vm *VM) stackTrace() StackTrace {
+	trace := StackTrace{}
+	for i := vm.frameIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		fn := frame.cl.Fn
+		// the current frame is at the failing instruction, the others are at the call they are waiting for
+		ip := frame.ip
+		if i == vm.frameIndex-1 {
+			ip = vm.opIp
+		}
+		name := fn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		trace = append(trace, TraceFrame{Function: name, Line: fn.Lines.Line(ip)})
+	}
+	return trace
+}
+
+// recoverRuntimeError turns a panic during Run into a RuntimeError, so that a faulty program
+// never crashes the host.
+func (vm *VM) recoverRuntimeError(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if r == errStackUnderflow {
+		*err = vm.newRuntimeError(errStackUnderflow)
+		return
+	}
+	*err = vm.newRuntimeError(fmt.Errorf("internal error: %v", r))
+}
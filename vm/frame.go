@@ -6,15 +6,17 @@ import (
 )
 
 type Frame struct {
-	fn     *object.CompiledFunction
-	ip     int
-	locals []object.Object
+	cl *object.Closure
+	ip int
+	// basePointer points to the first local slot of this frame in vm.stack,
+	// the slot right below it holds the callee.
+	basePointer int
 }
 
-func NewFrame(fn *object.CompiledFunction) *Frame {
-	return &Frame{fn: fn, ip: -1}
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
 }
 
 func (f *Frame) Instructions() code.Instructions {
-	return f.fn.Instructions
+	return f.cl.Fn.Instructions
 }
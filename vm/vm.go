@@ -11,6 +11,21 @@ const StackSize = 2048
 const GlobalSize = 65536
 const MaxFrames = 1024
 
+// binaryOperators maps the opcodes of the binary operators to the operators of the object package
+var binaryOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpLessThan:     "<",
+	code.OpGreaterEqual: ">=",
+	code.OpLessEqual:    "<=",
+}
+
 var True = &object.Boolean{Value: true}
 var False = &object.Boolean{Value: false}
 var Null = &object.Null{}
@@ -21,13 +36,20 @@ type VM struct {
 	sp         int
 	lastPopped object.Object
 	globals    []object.Object
-	frames     []*Frame
-	frameIndex int
+	// globalNames are the names of the globals by index
+	globalNames []string
+	frames      []*Frame
+	frameIndex  int
+	// openCells are the cells of the captured locals of the running frames, by stack slot
+	openCells map[int]*object.Cell
+	// op and opIp are the instruction being executed, they locate runtime errors
+	op   code.Opcode
+	opIp int
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	fn := &object.CompiledFunction{Instructions: bytecode.Instructions}
-	mainFrame := NewFrame(fn)
+	fn := &object.CompiledFunction{Instructions: bytecode.Instructions, Name: "<main>", Lines: bytecode.Lines}
+	mainFrame := NewFrame(&object.Closure{Fn: fn}, 0)
 	frames := make([]*Frame, MaxFrames)
 	frames[0] = mainFrame
 	return &VM{
@@ -35,9 +57,11 @@ func New(bytecode *compiler.Bytecode) *VM {
 		stack:     make([]object.Object, StackSize),
 		sp:        0,
 		// @Optimization: we can determine the globalsize at compile time, and reduce the array size
-		globals:    make([]object.Object, GlobalSize),
-		frames:     frames,
-		frameIndex: 1,
+		globals:     make([]object.Object, GlobalSize),
+		globalNames: bytecode.GlobalNames,
+		frames:      frames,
+		frameIndex:  1,
+		openCells:   make(map[int]*object.Cell),
 	}
 }
 
@@ -55,12 +79,22 @@ func (vm *VM) StackTop() object.Object {
 	}
 }
 
-func (vm *VM) Run() error {
+// Run executes the bytecode, any error is returned as a *RuntimeError.
+func (vm *VM) Run() (err error) {
+	defer vm.recoverRuntimeError(&err)
+	if err := vm.run(); err != nil {
+		return vm.newRuntimeError(err)
+	}
+	return nil
+}
+
+func (vm *VM) run() error {
 	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 		vm.currentFrame().ip++
 		ip := vm.currentFrame().ip
 		ins := vm.currentFrame().Instructions()
 		op := code.Opcode(ins[ip])
+		vm.op, vm.opIp = op, ip
 		switch op {
 		case code.Opconst:
 			constIndex := code.ReadUint16(ins[ip+1:])
@@ -73,73 +107,28 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod:
 			right := vm.pop()
 			left := vm.pop()
-			switch {
-			case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-				leftVal := left.(*object.Integer).Value
-				rightVal := right.(*object.Integer).Value
-				var res int64
-				switch op {
-				case code.OpAdd:
-					res = leftVal + rightVal
-				case code.OpSub:
-					res = leftVal - rightVal
-				case code.OpMul:
-					res = leftVal * rightVal
-				case code.OpDiv:
-					res = leftVal / rightVal
-				}
-				vm.push(&object.Integer{Value: res})
-			case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-				leftVal := left.(*object.String).Value
-				rightVal := right.(*object.String).Value
-				if op != code.OpAdd {
-					return fmt.Errorf("unsupported operator for string type")
-				}
-				vm.push(&object.String{Value: leftVal + rightVal})
-			default:
-				return fmt.Errorf("unsupported types for binary operation: %s %s", left.Type(), right.Type())
+			res, err := object.BinaryOp(binaryOperators[op], left, right)
+			if err != nil {
+				return err
+			}
+			err = vm.push(res)
+			if err != nil {
+				return err
 			}
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
-			var res bool
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan, code.OpGreaterEqual, code.OpLessEqual:
 			right := vm.pop()
 			left := vm.pop()
-			if left.Type() != right.Type() {
-				return fmt.Errorf("unsupported types for comparison operation: %s %s", left.Type(), right.Type())
-			}
-			if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
-				leftVal := left.(*object.Integer).Value
-				rightVal := right.(*object.Integer).Value
-				switch op {
-				case code.OpEqual:
-					res = (leftVal == rightVal)
-				case code.OpNotEqual:
-					res = (leftVal != rightVal)
-				case code.OpGreaterThan:
-					res = (leftVal > rightVal)
-				case code.OpLessThan:
-					res = (leftVal < rightVal)
-				}
+			res, err := object.Compare(binaryOperators[op], left, right)
+			if err != nil {
+				return err
 			}
-			if left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ {
-				leftVal := left.(*object.Boolean).Value
-				rightVal := right.(*object.Boolean).Value
-				switch op {
-				case code.OpEqual:
-					res = (leftVal == rightVal)
-				case code.OpNotEqual:
-					res = (leftVal != rightVal)
-				// @Optimize: this error could be reported at compile time (instead of run time)
-				case code.OpGreaterThan:
-					return fmt.Errorf("unsupported types for > operator: %s %s", left.Type(), right.Type())
-				case code.OpLessThan:
-					return fmt.Errorf("unsupported types for < operator: %s %s", left.Type(), right.Type())
-				}
+			err = vm.push(nativeBool2BooleanObject(res))
+			if err != nil {
+				return err
 			}
-			vm.push(nativeBool2BooleanObject(res))
-
 		case code.OpTrue:
 			err := vm.push(True)
 			if err != nil {
@@ -152,6 +141,11 @@ func (vm *VM) Run() error {
 			}
 		case code.OpBang:
 			vm.executeBangOperator()
+		case code.OpMinus:
+			err := vm.executeMinusOperator()
+			if err != nil {
+				return err
+			}
 		case code.OpNull:
 			err := vm.push(Null)
 			if err != nil {
@@ -162,13 +156,13 @@ func (vm *VM) Run() error {
 		case code.OpJump:
 			// off set: -1, so the next iteration jumps to the correct position
 			pos := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip = int(pos - 1)
+			vm.currentFrame().ip = int(pos) - 1
 		case code.OpJumpNotTruthy:
 			pos := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
 			condition := vm.pop()
 			if !isTruthy(condition) {
-				vm.currentFrame().ip = int(pos - 1)
+				vm.currentFrame().ip = int(pos) - 1
 			}
 		case code.OpSetGlobal:
 			index := code.ReadUint16(ins[ip+1:])
@@ -178,6 +172,10 @@ func (vm *VM) Run() error {
 			index := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
 			val := vm.globals[index]
+			// a hoisted function is unset until its let statement runs
+			if val == nil {
+				return fmt.Errorf("identifier '%s' not bind to any expression", vm.globalNames[index])
+			}
 			err := vm.push(val)
 			if err != nil {
 				return err
@@ -195,29 +193,164 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpBuildString:
+			count := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			parts := make([]object.Object, count)
+			for i := 0; i < count; i++ {
+				parts[count-1-i] = vm.pop()
+			}
+			err := vm.push(object.BuildString(parts))
+			if err != nil {
+				return err
+			}
+		case code.OpHash:
+			count := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			hash, err := vm.buildHash(vm.sp-count, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - count
+			err = vm.push(hash)
+			if err != nil {
+				return err
+			}
 		case code.OpIndex:
 			index := vm.pop()
-			arr := vm.pop()
-			if arr.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ {
-				i := index.(*object.Integer).Value
-				a := arr.(*object.Array).Value
-				err := vm.push(a[i])
+			left := vm.pop()
+			switch {
+			case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+				err := vm.executeArrayIndex(left.(*object.Array), index.(*object.Integer).Value)
+				if err != nil {
+					return err
+				}
+			case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+				err := vm.executeStringIndex(left.(*object.String), index.(*object.Integer).Value)
+				if err != nil {
+					return err
+				}
+			case left.Type() == object.HASH_OBJ:
+				err := vm.executeHashIndex(left.(*object.Hash), index)
 				if err != nil {
 					return err
 				}
-			} else {
-				return fmt.Errorf("we currently only support array access, expect ARRAY_OBJ and INTEGER_OBJ types, but got %s, %s", arr.Type(), index.Type())
+			default:
+				return fmt.Errorf("index operator not supported: %s[%s]", left.Type(), index.Type())
+			}
+		case code.OpSetLocal:
+			index := int(code.ReadUint8(ins[ip+1:]))
+			frame := vm.currentFrame()
+			frame.ip += 1
+			vm.stack[frame.basePointer+index] = vm.pop()
+		case code.OpGetLocal:
+			index := int(code.ReadUint8(ins[ip+1:]))
+			frame := vm.currentFrame()
+			frame.ip += 1
+			err := vm.push(vm.stack[frame.basePointer+index])
+			if err != nil {
+				return err
+			}
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := int(code.ReadUint8(ins[ip+3:]))
+			vm.currentFrame().ip += 3
+			err := vm.pushClosure(int(constIndex), numFree)
+			if err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			index := code.ReadUint8(ins[ip+1:])
+			frame := vm.currentFrame()
+			frame.ip += 1
+			err := vm.push(frame.cl.Free[index].Get())
+			if err != nil {
+				return err
+			}
+		case code.OpSetFree:
+			index := code.ReadUint8(ins[ip+1:])
+			frame := vm.currentFrame()
+			frame.ip += 1
+			frame.cl.Free[index].Set(vm.pop())
+		case code.OpGetLocalCell:
+			index := int(code.ReadUint8(ins[ip+1:]))
+			frame := vm.currentFrame()
+			frame.ip += 1
+			err := vm.push(vm.localCell(frame.basePointer + index))
+			if err != nil {
+				return err
+			}
+		case code.OpGetFreeCell:
+			index := code.ReadUint8(ins[ip+1:])
+			frame := vm.currentFrame()
+			frame.ip += 1
+			err := vm.push(frame.cl.Free[index])
+			if err != nil {
+				return err
+			}
+		case code.OpCheckIterable:
+			switch iterable := vm.stack[vm.sp-1]; iterable.(type) {
+			case *object.Array, *object.String:
+			default:
+				return fmt.Errorf("cannot iterate over %s", iterable.Type())
+			}
+		case code.OpGetBuiltin:
+			index := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err := vm.push(object.Builtins[index].Builtin)
+			if err != nil {
+				return err
+			}
+		case code.OpCurrentClosure:
+			err := vm.push(vm.currentFrame().cl)
+			if err != nil {
+				return err
+			}
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err := object.SetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
+			err = vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+			err := vm.executeSlice(left, start, end)
+			if err != nil {
+				return err
 			}
 		case code.OpCall:
-			fn, ok := vm.pop().(*object.CompiledFunction)
-			if !ok {
-				return fmt.Errorf("calling non-function")
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+			err := vm.callFunction(numArgs)
+			if err != nil {
+				return err
 			}
-			vm.pushFrame(NewFrame(fn))
 		case code.OpReturnValue:
-			vm.popFrame()
+			returnValue := vm.pop()
+			// a return at the top level ends the program, the returned value is its result
+			if vm.frameIndex == 1 {
+				return nil
+			}
+			frame := vm.popFrame()
+			vm.closeCells(frame.basePointer)
+			// also drops the callee sitting right below the locals
+			vm.sp = frame.basePointer - 1
+			err := vm.push(returnValue)
+			if err != nil {
+				return err
+			}
 		case code.OpReturn:
-			vm.popFrame()
+			frame := vm.popFrame()
+			vm.closeCells(frame.basePointer)
+			vm.sp = frame.basePointer - 1
 			err := vm.push(Null)
 			if err != nil {
 				return err
@@ -229,6 +362,162 @@ func (vm *VM) Run() error {
 	return nil
 }
 
+// callFunction expects the callee followed by its numArgs arguments on top of the stack.
+func (vm *VM) callFunction(numArgs int) error {
+	switch callee := vm.stack[vm.sp-1-numArgs].(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("calling non-function")
+	}
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+	if err, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", err.ErrorMessage)
+	}
+	if result == nil {
+		return vm.push(Null)
+	}
+	return vm.push(result)
+}
+
+// callClosure makes the arguments the first locals of the new frame, the remaining local
+// slots are reserved right above them.
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	fn := cl.Fn
+	if numArgs != fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", fn.NumParameters, numArgs)
+	}
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if frame.basePointer+fn.NumLocals >= StackSize || vm.frameIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+	vm.pushFrame(frame)
+	vm.sp = frame.basePointer + fn.NumLocals
+	return nil
+}
+
+// pushClosure wraps the compiled function at constIndex into a closure, capturing
+// the numFree cells on top of the stack, a value that isn't a cell is captured by value.
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	fn, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", vm.constants[constIndex])
+	}
+	free := make([]*object.Cell, numFree)
+	for i := 0; i < numFree; i++ {
+		captured := vm.stack[vm.sp-numFree+i]
+		cell, ok := captured.(*object.Cell)
+		if !ok {
+			cell = object.NewClosedCell(captured)
+		}
+		free[i] = cell
+	}
+	vm.sp = vm.sp - numFree
+	return vm.push(&object.Closure{Fn: fn, Free: free})
+}
+
+// localCell returns the cell of the local at the given stack slot, all the closures capturing
+// the local share it.
+func (vm *VM) localCell(slot int) *object.Cell {
+	cell, ok := vm.openCells[slot]
+	if !ok {
+		cell = object.NewCell(&vm.stack[slot])
+		vm.openCells[slot] = cell
+	}
+	return cell
+}
+
+// closeCells closes the cells of the locals of a returning frame, whose slots start at basePointer.
+func (vm *VM) closeCells(basePointer int) {
+	for slot, cell := range vm.openCells {
+		if slot >= basePointer {
+			cell.Close()
+			delete(vm.openCells, slot)
+		}
+	}
+}
+
+// buildHash builds a hash from the alternating keys and values in vm.stack[start:end].
+func (vm *VM) buildHash(start int, end int) (object.Object, error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+	for i := start; i < end; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+func (vm *VM) executeArrayIndex(array *object.Array, index int64) error {
+	i, ok := object.NormalizeIndex(index, len(array.Value))
+	if !ok {
+		return vm.pushOutOfRange(index, len(array.Value))
+	}
+	return vm.push(array.Value[i])
+}
+
+// executeStringIndex indexes a string by code point, not by byte.
+func (vm *VM) executeStringIndex(str *object.String, index int64) error {
+	runes := []rune(str.Value)
+	i, ok := object.NormalizeIndex(index, len(runes))
+	if !ok {
+		return vm.pushOutOfRange(index, len(runes))
+	}
+	return vm.push(&object.String{Value: string(runes[i])})
+}
+
+func (vm *VM) executeSlice(left, start, end object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		lo, hi, err := object.SliceBounds(start, end, len(left.Value))
+		if err != nil {
+			return err
+		}
+		elements := make([]object.Object, hi-lo)
+		copy(elements, left.Value[lo:hi])
+		return vm.push(&object.Array{Value: elements})
+	case *object.String:
+		runes := []rune(left.Value)
+		lo, hi, err := object.SliceBounds(start, end, len(runes))
+		if err != nil {
+			return err
+		}
+		return vm.push(&object.String{Value: string(runes[lo:hi])})
+	default:
+		return fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) pushOutOfRange(index int64, length int) error {
+	if object.IndexOutOfRange == object.OutOfRangeError {
+		return fmt.Errorf("index out of range: %d (length %d)", index, length)
+	}
+	return vm.push(Null)
+}
+
+func (vm *VM) executeHashIndex(hash *object.Hash, index object.Object) error {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+	pair, ok := hash.Pairs[key.HashKey()]
+	if !ok {
+		return vm.push(Null)
+	}
+	return vm.push(pair.Value)
+}
+
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.frameIndex-1]
 }
@@ -252,21 +541,24 @@ func isTruthy(obj object.Object) bool {
 	default:
 		return true
 	}
-
-	c := obj.(*object.Boolean)
-	return c.Value
 }
 
 func (vm *VM) push(obj object.Object) error {
 	if obj == nil {
 		return fmt.Errorf("vm push error: the pushed object is nil")
 	}
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
 	vm.stack[vm.sp] = obj
 	vm.sp++
 	return nil
 }
 
 func (vm *VM) pop() object.Object {
+	if vm.sp == 0 {
+		panic(errStackUnderflow)
+	}
 	obj := vm.StackTop()
 	vm.stack[vm.sp-1] = nil
 	vm.lastPopped = obj
@@ -283,6 +575,14 @@ func (vm *VM) executeBangOperator() error {
 	}
 }
 
+func (vm *VM) executeMinusOperator() error {
+	res, err := object.Negate(vm.pop())
+	if err != nil {
+		return err
+	}
+	return vm.push(res)
+}
+
 func (vm *VM) LastPopped() object.Object {
 	return vm.lastPopped
 }
@@ -2,16 +2,22 @@ package vm
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"monkey/ast"
+	"monkey/code"
 	"monkey/compiler"
+	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"reflect"
+	"strings"
 	"testing"
 )
 
 func parse(input string) *ast.Program {
-	l := lexer.New(input)
+	l := lexer.New("", input)
 	p := parser.New(l)
 	return p.ParseProgram()
 }
@@ -27,6 +33,17 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got%T(%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object value is not expected. want=%g, got=%g", expected, result.Value)
+	}
+	return nil
+}
+
 func testBooleanObject(expected bool, actual object.Object) error {
 	result, ok := actual.(*object.Boolean)
 	if !ok {
@@ -74,6 +91,39 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 	}
 }
 
+// engineTestCase is run with the VM and with the evaluator, expected is the output of both, i.e.
+// the inspected result or the error message.
+type engineTestCase struct {
+	input    string
+	expected string
+}
+
+func runEngineTests(t *testing.T, tests []engineTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input), 0)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		var vmOutput string
+		if err := vm.Run(); err != nil {
+			vmOutput = err.Error()
+		} else {
+			vmOutput = vm.LastPopped().Inspect()
+		}
+		if vmOutput != tt.expected {
+			t.Errorf("%s: wrong VM output: want=%q, got=%q", tt.input, tt.expected, vmOutput)
+		}
+		evalOutput := evaluator.Eval(parse(tt.input), object.NewEnvironment()).Inspect()
+		if evalOutput != tt.expected {
+			t.Errorf("%s: wrong evaluator output: want=%q, got=%q", tt.input, tt.expected, evalOutput)
+		}
+	}
+}
+
 func testExpectedObject(t *testing.T, expected any, actual object.Object) {
 	t.Helper()
 	switch expected := expected.(type) {
@@ -82,6 +132,20 @@ func testExpectedObject(t *testing.T, expected any, actual object.Object) {
 		if err != nil {
 			t.Errorf("testIntegerObject failed: %s", err)
 		}
+	case *big.Int:
+		result, ok := actual.(*object.BigInt)
+		if !ok {
+			t.Errorf("object is not BigInt. got=%T (%+v)", actual, actual)
+			return
+		}
+		if result.Value.Cmp(expected) != 0 {
+			t.Errorf("object value is not expected. want=%s, got=%s", expected, result.Value)
+		}
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("testFloatObject failed: %s", err)
+		}
 	case bool:
 		err := testBooleanObject(bool(expected), actual)
 		if err != nil {
@@ -109,6 +173,27 @@ func testExpectedObject(t *testing.T, expected any, actual object.Object) {
 				t.Errorf("testIntegerObject failed: %s", err)
 			}
 		}
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not Hash. got=%T (%+v)", actual, actual)
+			return
+		}
+		if len(hash.Pairs) != len(expected) {
+			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d",
+				len(expected), len(hash.Pairs))
+			return
+		}
+		for expectedKey, expectedValue := range expected {
+			pair, ok := hash.Pairs[expectedKey]
+			if !ok {
+				t.Errorf("no pair for given key in Pairs")
+			}
+			err := testIntegerObject(expectedValue, pair.Value)
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
 	case *object.Null:
 		if actual != Null {
 			t.Errorf("test Null failed")
@@ -184,11 +269,26 @@ func TestGlobalLetStatements(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestTopLevelReturns(t *testing.T) {
+	tests := []engineTestCase{
+		{"return 5;", "5"},
+		{"return 5; 10", "5"},
+		{"if (true) { return 1; } 2", "1"},
+		{"let f = fn() { 2 }; return f(); 3", "2"},
+		{"for (x in [1, 2]) { if (x == 2) { return x; } }", "2"},
+		{"while (true) { if (true) { return \"a\"; } }", "a"},
+	}
+	runEngineTests(t, tests)
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{`"monkey"`, "monkey"},
 		{`"mon" + "key"`, "monkey"},
 		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`"say \"hi\"\n"`, "say \"hi\"\n"},
+		{"`C:\\dir\\` + \"\\u{e9}\"", `C:\dir\é`},
+		{`len("\t\u{1F600}")`, 2},
 	}
 	runVmTests(t, tests)
 }
@@ -275,3 +375,1035 @@ returnsOneReturner()();
 	}
 	runVmTests(t, tests)
 }
+
+func TestCallingFunctionsWithArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+let identity = fn(a) { a; };
+identity(4);
+`,
+			expected: 4,
+		},
+		{
+			input: `
+let sum = fn(a, b) { a + b; };
+sum(1, 2);
+`,
+			expected: 3,
+		},
+		{
+			input: `
+let sum = fn(a, b) { a + b; };
+let outer = fn() { sum(1, 2) + sum(3, 4); };
+outer();
+`,
+			expected: 10,
+		},
+		{
+			input: `
+let first = fn(a, b) { a };
+let second = fn(a, b) { b };
+first(1, 2) * 10 + second(3, 4);
+`,
+			expected: 14,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `fn() { 1; }(1);`,
+			expected: `wrong number of arguments: want=0, got=1`,
+		},
+		{
+			input:    `fn(a) { a; }();`,
+			expected: `wrong number of arguments: want=1, got=0`,
+		},
+		{
+			input:    `fn(a, b) { a + b; }(1);`,
+			expected: `wrong number of arguments: want=2, got=1`,
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program, 0)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestCallingFunctionsWithBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+let one = fn() { let one = 1; one };
+one();
+`,
+			expected: 1,
+		},
+		{
+			input: `
+let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+oneAndTwo();
+`,
+			expected: 3,
+		},
+		{
+			input: `
+let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+let threeAndFour = fn() { let three = 3; let four = 4; three + four; };
+oneAndTwo() + threeAndFour();
+`,
+			expected: 10,
+		},
+		{
+			input: `
+let firstFoobar = fn() { let foobar = 50; foobar; };
+let secondFoobar = fn() { let foobar = 100; foobar; };
+firstFoobar() + secondFoobar();
+`,
+			expected: 150,
+		},
+		{
+			input: `
+let globalSeed = 50;
+let minusOne = fn() {
+	let num = 1;
+	globalSeed - num;
+}
+let minusTwo = fn() {
+	let num = 2;
+	globalSeed - num;
+}
+minusOne() + minusTwo();
+`,
+			expected: 97,
+		},
+		{
+			input: `
+let sum = fn(a, b) {
+	let c = a + b;
+	c;
+};
+let outer = fn() {
+	let a = 10;
+	sum(1, 2) + sum(3, 4) + a;
+};
+outer();
+`,
+			expected: 20,
+		},
+		{
+			input: `
+let a = 1;
+let shadow = fn() { let a = 2; a; };
+shadow() + a;
+`,
+			expected: 3,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+let newClosure = fn(a) {
+	fn() { a; };
+};
+let closure = newClosure(99);
+closure();
+`,
+			expected: 99,
+		},
+		{
+			input: `
+let makeAdder = fn(x) { fn(y) { x + y } };
+let addTwo = makeAdder(2);
+let addTen = makeAdder(10);
+addTwo(3) + addTen(5);
+`,
+			expected: 20,
+		},
+		{
+			input: `
+let newAdder = fn(a, b) {
+	let c = a + b;
+	fn(d) { c + d };
+};
+let adder = newAdder(1, 2);
+adder(8);
+`,
+			expected: 11,
+		},
+		{
+			input: `
+let newAdderOuter = fn(a, b) {
+	let c = a + b;
+	fn(d) {
+		let e = d + c;
+		fn(f) { e + f; };
+	};
+};
+let newAdderInner = newAdderOuter(1, 2)
+let adder = newAdderInner(3);
+adder(8);
+`,
+			expected: 14,
+		},
+		{
+			input: `
+let a = 1;
+let newAdderOuter = fn(b) {
+	fn(c) {
+		fn(d) { a + b + c + d };
+	};
+};
+let newAdderInner = newAdderOuter(2)
+let adder = newAdderInner(3);
+adder(8);
+`,
+			expected: 14,
+		},
+		{
+			input: `
+let newClosure = fn(a, b) {
+	let one = fn() { a; };
+	let two = fn() { b; };
+	fn() { one() + two(); };
+};
+let closure = newClosure(9, 90);
+closure();
+`,
+			expected: 99,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+// captured variables are shared by reference, like in the evaluator
+func TestCapturedVariableAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn() { let i = 0; let g = fn() { i }; i = 5; g() }; f()", 5},
+		{"let f = fn() { let i = 0; let g = fn() { i }; i += 5; g() }; f()", 5},
+		{"let counter = fn() { let n = 0; fn() { n += 1; n } }; let c = counter(); c(); c(); c()", 3},
+		{"let counter = fn() { let n = 0; fn() { n += 1; n } }; let a = counter(); let b = counter(); a(); a(); b()", 1},
+		{"let mk = fn() { let n = 0; let inc = fn() { n += 1 }; let get = fn() { n }; [inc, get] }; let p = mk(); p[0](); p[0](); p[1]()", 2},
+		{"let f = fn(x) { let set = fn(v) { x = v }; set(7); x }; f(1)", 7},
+		{"let f = fn() { let n = 1; let g = fn() { fn() { n *= 10 } }; g()(); g()(); n }; f()", 100},
+	}
+	runVmTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+let countDown = fn(x) {
+	if (x == 0) {
+		return 0;
+	} else {
+		countDown(x - 1);
+	}
+};
+countDown(1);
+`,
+			expected: 0,
+		},
+		{
+			input: `
+let wrapper = fn() {
+	let countDown = fn(x) {
+		if (x == 0) {
+			return 0;
+		} else {
+			countDown(x - 1);
+		}
+	};
+	countDown(1);
+};
+wrapper();
+`,
+			expected: 0,
+		},
+		{
+			input: `
+let fibonacci = fn(x) {
+	if (x == 0) {
+		return 0;
+	} else {
+		if (x == 1) {
+			return 1;
+		} else {
+			fibonacci(x - 1) + fibonacci(x - 2);
+		}
+	}
+};
+fibonacci(15);
+`,
+			expected: 610,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestReassignedRecursiveGlobals(t *testing.T) {
+	tests := []engineTestCase{
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; let g = f; f = fn(n) { 100 }; g(1)", "100"},
+		{"let f = fn() { f = 1 }; f(); f", "1"},
+		{"if (true) { let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(3) }", "0"},
+		{"let wrapper = fn() { let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(3) }; wrapper()", "0"},
+	}
+	runEngineTests(t, tests)
+}
+
+func TestMutuallyRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+isEven(10);
+`,
+			expected: true,
+		},
+		{
+			input: `
+let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+isOdd(7);
+`,
+			expected: true,
+		},
+		{
+			input: `
+let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+isEven(7);
+`,
+			expected: false,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			"{}", map[object.HashKey]int64{},
+		},
+		{
+			"{1: 2, 2: 3}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 2,
+				(&object.Integer{Value: 2}).HashKey(): 3,
+			},
+		},
+		{
+			"{1 + 1: 2 * 2, 3 + 3: 4 * 4}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 2}).HashKey(): 4,
+				(&object.Integer{Value: 6}).HashKey(): 16,
+			},
+		},
+		{
+			`{"one": 1, true: 2}`,
+			map[object.HashKey]int64{
+				(&object.String{Value: "one"}).HashKey(): 1,
+				(&object.Boolean{Value: true}).HashKey(): 2,
+			},
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestHashLiteralEvaluationOrder(t *testing.T) {
+	tests := []engineTestCase{
+		{`{"a": 1, "a": 2}["a"]`, "2"},
+		{`{"b": 1, "a": 2, "b": 3}["b"]`, "3"},
+		{`let s = ""; let f = fn(x) { s += x; x }; {f("c"): 1, f("a"): 2, f("b"): 3}; s`, "cab"},
+	}
+	for i := 0; i < 10; i++ {
+		runEngineTests(t, tests)
+	}
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+		{"[1, 2, 3][0 + 2]", 3},
+		{"let arr = [1, 2, 3]; let i = 1; arr[i]", 2},
+		{"let arr = [1, 2, 3]; arr[len(arr) - 1]", 3},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][3]", Null},
+		{"[1, 2, 3][-4]", Null},
+		{"[][0]", Null},
+		{`{"one": 1, "two": 2}["two"]`, 2},
+		{`let key = "one"; {"one": 1}[key]`, 1},
+		{`{true: 5}[1 < 2]`, 5},
+		{`"monkey"[0]`, "m"},
+		{`"monkey"[-1]`, "y"},
+		{`"monkey"[6]`, Null},
+	}
+	runVmTests(t, tests)
+}
+
+func TestIndexOutOfRangeErrors(t *testing.T) {
+	object.IndexOutOfRange = object.OutOfRangeError
+	defer func() { object.IndexOutOfRange = object.OutOfRangeNull }()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3][3]", "index out of range: 3 (length 3)"},
+		{"[1, 2, 3][-4]", "index out of range: -4 (length 3)"},
+		{`"abc"[5]`, "index out of range: 5 (length 3)"},
+		{`{1: 2}[[1]]`, "unusable as hash key: ARRAY"},
+		{`1[0]`, "index operator not supported: INTEGER[INTEGER]"},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program, 0)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+	runVmTests(t, []vmTestCase{{"[1, 2, 3][-1]", 3}})
+}
+
+func TestUnhashableKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{`{fn() { 1 }: 2}`, "unusable as hash key: CLOSURE"},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program, 0)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`puts("hello", "world!")`, Null},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, Null},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, Null},
+		{`push([], 1)`, []int{1}},
+		{`let len = fn(x) { 7 }; len([])`, 7},
+		{`let count = fn(arr) { len(arr) }; count([1, 2])`, 2},
+	}
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len(true)`, "len (currently) doesn't support BOOLEAN type"},
+		{`len("one", "two")`, "len(): expect 1 arguments, but got 2"},
+		{`first(1)`, "first(): argument must be ARRAY, got INTEGER"},
+		{`push(1, 1)`, "push(): first argument must be ARRAY, got INTEGER"},
+		{`int("1.5")`, `int(): can't parse "1.5" as INTEGER`},
+		{`float(true)`, "float(): argument must be INTEGER, FLOAT or STRING, got BOOLEAN"},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program, 0)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestPrefixMinus(t *testing.T) {
+	tests := []vmTestCase{
+		{"-5", -5},
+		{"-10", -10},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"-50 + 100 + -50", 0},
+		{"let a = 3; -a * 2 - 1", -7},
+		{"!true == false", true},
+	}
+	runVmTests(t, tests)
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][3:1]", []int{}},
+		{"[1, 2, 3, 4][-10:10]", []int{1, 2, 3, 4}},
+		{"let arr = [1, 2, 3]; let i = 1; arr[i:len(arr)]", []int{2, 3}},
+		{`"monkey"[1:3]`, "on"},
+		{`"monkey"[:3]`, "mon"},
+		{`"monkey"[3:]`, "key"},
+		{`"monkey"[-3:]`, "key"},
+		{`"monkey"[4:2]`, ""},
+	}
+	runVmTests(t, tests)
+}
+
+func TestSlicesAreCopies(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1, 2, 3]; let b = a[:]; push(b, 4); a", []int{1, 2, 3}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; while (false) { x; }; x", 1},
+		{"let f = fn() { while (true) { return 5; } }; f()", 5},
+		{"let f = fn() { while (true) { break; } 7 }; f()", 7},
+		{"let f = fn(n) { while (n > 0) { return n; } 0 }; f(3)", 3},
+		{"let f = fn(n) { while (n > 0) { if (n == 3) { break; } } n }; f(3)", 3},
+		{"if (true) { while (false) { } }", Null},
+		// a loop at the start of a function body jumps back to offset 0
+		{"let f = fn(n) { while (n > 0) { n = n - 1 }; n + 100 }; f(3)", 100},
+		{"let f = fn(n) { while (n > 0) { n -= 1; if (n > 1) { continue; } }; n }; f(5)", 0},
+		{"while (false) { }; let i = 0; while (i < 3) { i += 1 }; i", 3},
+	}
+	runVmTests(t, tests)
+}
+
+func TestForInLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+let firstAbove = fn(arr, limit) {
+	for (x in arr) {
+		if (x > limit) { break; }
+	}
+	x;
+};
+firstAbove([1, 2, 3, 4], 2);
+`,
+			expected: 3,
+		},
+		{
+			input: `
+let collect = fn(arr) {
+	for (x in arr) {
+		if (x == 2) { continue; }
+		x;
+	}
+	x;
+};
+collect([1, 2, 3, 2]);
+`,
+			expected: 2,
+		},
+		{
+			input:    `let f = fn() { for (c in "abc"[1:]) { return c; } }; f()`,
+			expected: "b",
+		},
+		{
+			input:    `let f = fn() { for (x in [[1, 2], [3, 4]]) { for (y in x) { if (y == 3) { return y; } } } }; f()`,
+			expected: 3,
+		},
+		{
+			input:    `for (x in [1, 2]) { }; for (x in [3, 4, 5]) { }; x`,
+			expected: 5,
+		},
+		{
+			input:    `let f = fn() { for (x in []) { return 1; } 0 }; f()`,
+			expected: 0,
+		},
+		{
+			input:    `let len = fn(x) { 0 }; let f = fn() { for (x in [1]) { return x; } }; f()`,
+			expected: 1,
+		},
+		{
+			input:    `let f = fn() { let fns = []; for (x in [1, 2]) { let g = fn() { x }; return g; } }; f()()`,
+			expected: 1,
+		},
+		{
+			input:    `for (x in [1]) { let t = x; }; for (y in [2]) { let t = y; }; t`,
+			expected: 2,
+		},
+		{
+			input:    `let f = fn() { for (x in [1]) { let t = x; }; for (y in [2]) { let t = y; }; t }; f()`,
+			expected: 2,
+		},
+		{
+			input:    `let f = fn() { let a = [0]; for (x in [1, 2, 3]) { a[0] += x; }; a[0] }; f()`,
+			expected: 6,
+		},
+		{
+			input:    `let f = fn() { let n = 0; for (x in [1, 2]) { for (y in [10, 20]) { n += x * y; } }; n }; f()`,
+			expected: 90,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestLoopControlsInIfStatements(t *testing.T) {
+	tests := []engineTestCase{
+		{"let n = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } else { if (x == 4) { break; } } n += x; }; n", "4"},
+		{"let n = 0; while (n < 10) { n += 1; if (n == 3) { break; }; }; n", "3"},
+		{"let n = 0; for (x in [1, 2]) { n += len([if (true) { x }]); if (true) { continue; } n += 1; }; n", "2"},
+	}
+	runEngineTests(t, tests)
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 1; a = 2; a", 2},
+		{"let a = 1; a = a + 1", 2},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		{"let a = 10; a += 5; a", 15},
+		{"let a = 10; a -= 5; a", 5},
+		{"let a = 10; a *= 5; a", 50},
+		{"let a = 10; a /= 5; a", 2},
+		{`let s = "mon"; s += "key"; s`, "monkey"},
+		{"let f = fn() { let a = 1; a = a + 1; a }; f()", 2},
+		{"let a = 1; let f = fn() { a = 5; }; f(); a", 5},
+		{"let i = 0; let sum = 0; while (i < 5) { i += 1; sum += i; }; sum", 15},
+		{"let i = 0; while (true) { i += 1; if (i > 3) { break; } }; i", 4},
+		{"let n = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } n += x; }; n", 8},
+		{"let a = [1, 2, 3]; a[0] = 5; a", []int{5, 2, 3}},
+		{"let a = [1, 2, 3]; a[-1] = 5; a", []int{1, 2, 5}},
+		{"let a = [1, 2, 3]; a[1] += 10; a", []int{1, 12, 3}},
+		{"let a = [1, 2, 3]; let b = a; b[0] = 9; a", []int{9, 2, 3}},
+		{"let a = [1, 2, 3]; a[0] = 7", 7},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] + h["b"]`, 3},
+		{`let h = {"a": 1}; h["a"] += 2; h["a"]`, 3},
+		{
+			input: `
+let calls = 0;
+let idx = fn() { calls += 1; 0 };
+let a = [1];
+a[idx()] += 1;
+calls;
+`,
+			expected: 1,
+		},
+		{"let set = fn(arr) { arr[0] = 1; }; let a = [0]; set(a); a", []int{1}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestIndexAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1]; a[1] = 2;", "index out of range: 1 (length 1)"},
+		{`let s = "abc"; s[0] = "x";`, "index assignment not supported: STRING[INTEGER]"},
+		{`let h = {}; h[[1]] = 1;`, "unusable as hash key: ARRAY"},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program, 0)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"true || false", true},
+		{"1 && 2", true},
+		{"let x = 5; x > 0 && x < 10", true},
+		{"let x = 15; x > 0 && x < 10", false},
+		{"let x = 15; x < 0 || x > 10", true},
+		{"1 == 1 && 2 == 2", true},
+		{"false && true || true", true},
+		{"true || false && false", true},
+		{"(if (false) { 1 }) || false", false},
+		{"let calls = 0; let f = fn() { calls += 1; true }; false && f(); calls", 0},
+		{"let calls = 0; let f = fn() { calls += 1; true }; true || f(); calls", 0},
+		{"let calls = 0; let f = fn() { calls += 1; true }; true && f(); calls", 1},
+		{"let i = 0; while (i < 10 && i != 3) { i += 1; }; i", 3},
+	}
+	runVmTests(t, tests)
+}
+
+func TestComparisonOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 7 % 3 * 2", 4},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" < "b"`, true},
+		{`"abc" > "abd"`, false},
+		{`"ab" < "abc"`, true},
+		{`"b" >= "abc"`, true},
+		{`"a" <= "a"`, true},
+	}
+	runVmTests(t, tests)
+}
+
+func TestUnsupportedOperands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 + "a"`, "unsupported operand types: INTEGER + STRING"},
+		{`"a" - "b"`, "unsupported operand types: STRING - STRING"},
+		{"true < false", "unsupported operand types: BOOLEAN < BOOLEAN"},
+		{"1 == true", "unsupported operand types: INTEGER == BOOLEAN"},
+		{"[1] % 2", "unsupported operand types: ARRAY % INTEGER"},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program, 0)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"1.5 + 2.25", 3.75},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"7 / 2", 3},
+		{"5.5 % 2", 1.5},
+		{"-2.5", -2.5},
+		{"1e3", 1000.0},
+		{"2.5E-1", 0.25},
+		{"1 == 1.0", true},
+		{"1 < 1.5", true},
+		{"2.5 >= 3", false},
+		{"let avg = fn(arr) { let sum = 0; for (x in arr) { sum += x; } sum / float(len(arr)) }; avg([1, 2])", 1.5},
+	}
+	runVmTests(t, tests)
+}
+
+func TestNumberLiterals(t *testing.T) {
+	maxPlusOne, _ := new(big.Int).SetString("9223372036854775808", 10)
+	tests := []vmTestCase{
+		{"0xFF + 0o17 + 0b1", 271},
+		{"1_000 * 1_000", 1000000},
+		{"0x7FFF_FFFF_FFFF_FFFF + 1", maxPlusOne},
+		{"1_0.2_5", 10.25},
+	}
+	runVmTests(t, tests)
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{"int(3.9)", 3},
+		{"int(-3.9)", -3},
+		{"int(7)", 7},
+		{`int("42")`, 42},
+		{"float(2)", 2.0},
+		{`float("0.25")`, 0.25},
+		{"float(1.5)", 1.5},
+	}
+	runVmTests(t, tests)
+}
+
+func TestBigIntegers(t *testing.T) {
+	maxPlusOne, _ := new(big.Int).SetString("9223372036854775808", 10)
+	minMinusOne, _ := new(big.Int).SetString("-9223372036854775809", 10)
+	huge, _ := new(big.Int).SetString("100000000000000000000", 10)
+	tests := []vmTestCase{
+		{"9223372036854775807 + 1", maxPlusOne},
+		{"(-9223372036854775807) - 2", minMinusOne},
+		{"10000000000 * 10000000000", huge},
+		{"100000000000000000000", huge},
+		{"(-9223372036854775807) - 1", math.MinInt64},
+		{"((-9223372036854775807) - 1) / -1", maxPlusOne},
+		{"-((-9223372036854775807) - 1)", maxPlusOne},
+		{"9223372036854775807 + 1 - 1", math.MaxInt64},
+		{"100000000000000000000 / 10000000000", 10000000000},
+		{"100000000000000000000 % 7", 2},
+		{"100000000000000000000 > 9223372036854775807", true},
+		{"(-100000000000000000000) < 0", true},
+		// prefix minus binds tighter than infix operators
+		{"-9223372036854775807 - 2", minMinusOne},
+		{"-(-9223372036854775807 - 1)", maxPlusOne},
+		{"-100000000000000000000 < 0", true},
+		{"100000000000000000000 == 10000000000 * 10000000000", true},
+		{"100000000000000000000 * 0.5", 5e19},
+		{"let fact = fn(n) { if (n < 2) { return 1; } n * fact(n - 1) }; fact(21) / fact(20)", 21},
+		{`{100000000000000000000: 1}[10000000000 * 10000000000]`, 1},
+		{"int(1e20)", huge},
+		{`int("100000000000000000000")`, huge},
+	}
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		opcode   code.Opcode
+	}{
+		{"1 / 0", "division by zero", code.OpDiv},
+		{"5 % 0", "modulo by zero", code.OpMod},
+		{"100000000000000000000 / 0", "division by zero", code.OpDiv},
+		{"let f = fn(x) { x / 0 }; f(1)", "division by zero", code.OpDiv},
+		{"-true", "unsupported type for negation: BOOLEAN", code.OpMinus},
+		{"let f = fn() { f() }; f()", "stack overflow", code.OpCall},
+		{"let f = fn(n) { if (n == 0) { return 0; } 1 + f(n - 1) }; f(5000)", "stack overflow", code.Opconst},
+		{"for (x in 5) { }", "cannot iterate over INTEGER", code.OpCheckIterable},
+		{"f(); let f = fn() { 1 };", "identifier 'f' not bind to any expression", code.OpGetGlobal},
+		{"let g = fn() { f() }; g(); let f = fn() { 1 };", "identifier 'f' not bind to any expression", code.OpGetGlobal},
+		{`let f = fn() { for (x in {"a": 1}) { } }; f()`, "cannot iterate over HASH", code.OpCheckIterable},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program, 0)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		rtErr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("%s: expected *RuntimeError, got=%T (%v)", tt.input, err, err)
+		}
+		if rtErr.Error() != tt.expected {
+			t.Errorf("%s: wrong VM error: want=%q, got=%q", tt.input, tt.expected, rtErr)
+		}
+		if rtErr.Opcode != tt.opcode {
+			t.Errorf("%s: wrong opcode: want=%d, got=%d", tt.input, tt.opcode, rtErr.Opcode)
+		}
+	}
+}
+
+func TestRuntimeErrorsFromMalformedBytecode(t *testing.T) {
+	tests := []struct {
+		instructions []code.Instructions
+		expected     string
+	}{
+		{[]code.Instructions{code.Make(code.OpPop)}, "stack underflow"},
+		{[]code.Instructions{code.Make(code.OpAdd)}, "stack underflow"},
+		{[]code.Instructions{code.Make(code.Opconst, 5)}, "internal error: runtime error: index out of range [5] with length 0"},
+	}
+	for _, tt := range tests {
+		bytecode := &compiler.Bytecode{}
+		for _, ins := range tt.instructions {
+			bytecode.Instructions = append(bytecode.Instructions, ins...)
+		}
+		err := New(bytecode).Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestRuntimeErrorStackTraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected StackTrace
+	}{
+		{
+			"1 +\n  true",
+			StackTrace{{"<main>", 1}},
+		},
+		{
+			`let divide = fn(a, b) {
+  a / b
+};
+let half = fn(x) {
+  divide(x,
+    0)
+};
+let y = 1;
+half(y)`,
+			StackTrace{{"divide", 2}, {"half", 5}, {"<main>", 9}},
+		},
+		{
+			`let apply = fn(f) { f() };
+apply(fn() {
+  [1][true]
+})`,
+			StackTrace{{"<anonymous>", 3}, {"apply", 1}, {"<main>", 2}},
+		},
+	}
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input), 0)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err = New(comp.Bytecode()).Run()
+		rtErr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("expected *RuntimeError, got=%T (%v)", err, err)
+		}
+		if !reflect.DeepEqual(rtErr.Trace, tt.expected) {
+			t.Errorf("wrong stack trace.\nwant=\n%sgot=\n%s", tt.expected, rtErr.Trace)
+		}
+	}
+}
+
+func TestStackTraceRendering(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let f = fn(n) { f(n + 1) };\nf(0)",
+			"\tat f (line 1)\n\t... repeated 1022 more times\n\tat <main> (line 2)\n",
+		},
+		{
+			"let isEven = fn(n) { isOdd(n) };\nlet isOdd = fn(n) { isEven(n) };\nisEven(0)",
+			strings.Repeat("\tat isEven (line 1)\n\tat isOdd (line 2)\n", 10) + "\t... 1004 more calls\n",
+		},
+	}
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input), 0)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err = New(comp.Bytecode()).Run()
+		rtErr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("expected *RuntimeError, got=%T (%v)", err, err)
+		}
+		if rtErr.Trace.String() != tt.expected {
+			t.Errorf("wrong stack trace.\nwant=\n%sgot=\n%s", tt.expected, rtErr.Trace)
+		}
+	}
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("héllo")`, 5},
+		{`len("日本語")`, 3},
+		{`"héllo"[1]`, "é"},
+		{`"日本語"[-1]`, "語"},
+		{`"日本語"[3]`, Null},
+		{`"héllo"[1:3]`, "él"},
+		{`let s = ""; for (c in "日本") { s = c + s; }; s`, "本日"},
+		{`bytes("é")`, []int{195, 169}},
+		{`runes("é!")`, []int{233, 33}},
+		{`len(bytes("日本語"))`, 9},
+	}
+	runVmTests(t, tests)
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{`let a = 1; let b = 2; "total: ${a + b}"`, "total: 3"},
+		{`"${1.5} ${true} ${"x"} ${len}"`, `1.5 true x builtin function`},
+		{`let greet = fn(name) { "hi ${name}!" }; greet("bob")`, "hi bob!"},
+		{`"${"nested ${1 + 1}"}"`, "nested 2"},
+		{`"cost: \${5}"`, "cost: ${5}"},
+	}
+	runVmTests(t, tests)
+}
+
+func TestUserDefinedOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{`infix 60 left <> = fn(a, b) { a + "-" + b }; "x" <> "y" <> "z"`, "x-y-z"},
+		{`infix 85 right ** = fn(a, b) { let r = 1; while (b > 0) { r *= a; b -= 1; } r }; 2 ** 3 ** 2`, 512},
+		{`infix 85 right ** = fn(a, b) { let r = 1; while (b > 0) { r *= a; b -= 1; } r }; 1 + 2 ** 2 * 3`, 13},
+		{`let join = fn(a, b) { push(a, b) }; infix 65 left |+| = join; [1] |+| 2 |+| 3`, []int{1, 2, 3}},
+		{`infix 60 left <> = fn(a, b) { a - b }; let f = fn(x) { x <> 1 }; f(10)`, 9},
+	}
+	runVmTests(t, tests)
+}